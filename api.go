@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/pbspro_exporter/collector"
+	"github.com/prometheus/common/log"
+)
+
+const (
+	apiPrefix       = "/api/v1/"
+	apiDefaultLimit = 100
+	apiMaxLimit     = 1000
+)
+
+// apiHandler serves the read-only JSON API under /api/v1/ from the cached
+// state of the PBS servers.
+type apiHandler struct {
+	handler *handler
+	// state returns the state of a server, collector.CurrentState unless
+	// replaced in tests.
+	state func(server collector.PBSServer) (*collector.State, error)
+}
+
+func newAPIHandler(h *handler, maxAge time.Duration) *apiHandler {
+	return &apiHandler{
+		handler: h,
+		state: func(server collector.PBSServer) (*collector.State, error) {
+			return collector.CurrentState(server, maxAge)
+		},
+	}
+}
+
+// apiResponse is the envelope of every response, as in the Prometheus API.
+type apiResponse struct {
+	Status   string      `json:"status"`
+	Data     interface{} `json:"data,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Warnings []string    `json:"warnings,omitempty"`
+}
+
+// apiPage is a page of a list of objects.
+type apiPage struct {
+	Items  interface{} `json:"items"`
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+}
+
+// The objects of the API are the objects of go_pbspro with the cluster, the
+// name of the PBS server they come from.
+type (
+	apiServer struct {
+		Cluster string    `json:"cluster"`
+		Address string    `json:"address"`
+		Time    time.Time `json:"time"`
+		qstat.QstatServerInfo
+	}
+	apiQueue struct {
+		Cluster string `json:"cluster"`
+		qstat.QstatQueueInfo
+	}
+	apiNode struct {
+		Cluster string `json:"cluster"`
+		// The node state is named State in JSON, the struct tag of
+		// go_pbspro being malformed.
+		qstat.QstatNodeInfo
+	}
+	apiJob struct {
+		Cluster string `json:"cluster"`
+		collector.Job
+	}
+)
+
+// apiError is an error with the HTTP status to respond with.
+type apiError struct {
+	status int
+	err    error
+}
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		h.respond(w, nil, nil, &apiError{http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)})
+		return
+	}
+	q := r.URL.Query()
+	var list func(states []*collector.State) ([]interface{}, error)
+	switch strings.TrimPrefix(r.URL.Path, apiPrefix) {
+	case "server":
+		list = func(states []*collector.State) ([]interface{}, error) {
+			return apiServers(states), nil
+		}
+	case "queues":
+		list = func(states []*collector.State) ([]interface{}, error) {
+			return apiQueues(states), nil
+		}
+	case "nodes":
+		list = func(states []*collector.State) ([]interface{}, error) {
+			return apiNodes(states, queryValues(q, "state")), nil
+		}
+	case "jobs":
+		list = func(states []*collector.State) ([]interface{}, error) {
+			return apiJobs(states, collector.JobFilter{
+				Users:  queryValues(q, "user"),
+				Queues: queryValues(q, "queue"),
+				States: queryValues(q, "state"),
+			})
+		}
+	default:
+		h.respond(w, nil, nil, &apiError{http.StatusNotFound, fmt.Errorf("unknown endpoint %s", r.URL.Path)})
+		return
+	}
+
+	offset, limit, err := pagination(q)
+	if err != nil {
+		h.respond(w, nil, nil, &apiError{http.StatusBadRequest, err})
+		return
+	}
+	states, warnings, err := h.states(queryValues(q, "cluster"))
+	if err != nil {
+		h.respond(w, nil, warnings, err)
+		return
+	}
+	items, err := list(states)
+	if err != nil {
+		h.respond(w, nil, warnings, &apiError{http.StatusBadRequest, err})
+		return
+	}
+
+	page := apiPage{Items: []interface{}{}, Total: len(items), Offset: offset, Limit: limit}
+	if offset < len(items) {
+		end := offset + limit
+		if end > len(items) {
+			end = len(items)
+		}
+		page.Items = items[offset:end]
+	}
+	h.respond(w, page, warnings, nil)
+}
+
+// states returns the states of the PBS servers named in clusters, or of all
+// servers if clusters is empty. Servers whose state could not be fetched are
+// reported as warnings, unless all of them failed.
+func (h *apiHandler) states(clusters []string) ([]*collector.State, []string, error) {
+	var servers []collector.PBSServer
+	for _, server := range h.handler.currentServers() {
+		if len(clusters) == 0 || contains(clusters, server.Name) {
+			servers = append(servers, server)
+		}
+	}
+	if len(servers) == 0 {
+		return nil, nil, &apiError{http.StatusNotFound, fmt.Errorf("no PBS server named %s", strings.Join(clusters, ", "))}
+	}
+
+	states, errs := fetchStates(servers, h.state)
+	var (
+		ok       []*collector.State
+		warnings []string
+	)
+	for i, err := range errs {
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("cluster %s: %s", servers[i].Name, err))
+			continue
+		}
+		ok = append(ok, states[i])
+	}
+	if len(ok) == 0 {
+		return nil, nil, &apiError{http.StatusServiceUnavailable, fmt.Errorf("couldn't get the state of PBS: %s", strings.Join(warnings, "; "))}
+	}
+	return ok, warnings, nil
+}
+
+func (h *apiHandler) respond(w http.ResponseWriter, data interface{}, warnings []string, err error) {
+	resp := apiResponse{Status: "success", Data: data, Warnings: warnings}
+	status := http.StatusOK
+	if err != nil {
+		resp = apiResponse{Status: "error", Error: err.Error()}
+		status = http.StatusInternalServerError
+		if e, ok := err.(*apiError); ok {
+			resp.Error = e.err.Error()
+			status = e.status
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Errorln("Error writing API response:", err)
+	}
+}
+
+func apiServers(states []*collector.State) []interface{} {
+	var items []interface{}
+	for _, s := range states {
+		for _, server := range s.Servers {
+			items = append(items, apiServer{Cluster: s.Server.Name, Address: s.Server.Address, Time: s.Time, QstatServerInfo: server})
+		}
+	}
+	return items
+}
+
+func apiQueues(states []*collector.State) []interface{} {
+	var items []interface{}
+	for _, s := range states {
+		for _, queue := range s.Queues {
+			items = append(items, apiQueue{Cluster: s.Server.Name, QstatQueueInfo: queue})
+		}
+	}
+	return items
+}
+
+// apiNodes returns the nodes with one of the given states, or all nodes if
+// there are none. A node can be in several states, e.g. down,offline.
+func apiNodes(states []*collector.State, nodeStates []string) []interface{} {
+	var items []interface{}
+	for _, s := range states {
+		for _, node := range s.Nodes {
+			if len(nodeStates) > 0 && !containsAny(nodeStates, strings.Split(node.State, ",")) {
+				continue
+			}
+			items = append(items, apiNode{Cluster: s.Server.Name, QstatNodeInfo: node})
+		}
+	}
+	return items
+}
+
+func apiJobs(states []*collector.State, filter collector.JobFilter) ([]interface{}, error) {
+	var items []interface{}
+	for _, s := range states {
+		jobs, err := s.Jobs(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range jobs {
+			items = append(items, apiJob{Cluster: s.Server.Name, Job: job})
+		}
+	}
+	return items, nil
+}
+
+// fetchStates returns the states of the servers, fetched concurrently with
+// state, and the errors of fetching them.
+func fetchStates(servers []collector.PBSServer, state func(collector.PBSServer) (*collector.State, error)) ([]*collector.State, []error) {
+	states := make([]*collector.State, len(servers))
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server collector.PBSServer) {
+			defer wg.Done()
+			states[i], errs[i] = state(server)
+		}(i, server)
+	}
+	wg.Wait()
+	return states, errs
+}
+
+// pagination returns the offset and limit query parameters.
+func pagination(q map[string][]string) (offset, limit int, err error) {
+	limit = apiDefaultLimit
+	parse := func(name string, v *int, max int) error {
+		values := q[name]
+		if len(values) == 0 {
+			return nil
+		}
+		n, err := strconv.Atoi(values[0])
+		if err != nil || n < 0 || (max > 0 && n > max) {
+			if max > 0 {
+				return fmt.Errorf("invalid %s %q, expected 0 to %d", name, values[0], max)
+			}
+			return fmt.Errorf("invalid %s %q", name, values[0])
+		}
+		*v = n
+		return nil
+	}
+	if err := parse("offset", &offset, 0); err != nil {
+		return 0, 0, err
+	}
+	if err := parse("limit", &limit, apiMaxLimit); err != nil {
+		return 0, 0, err
+	}
+	return offset, limit, nil
+}
+
+// queryValues returns the values of a query parameter, which can be repeated
+// or hold a comma-separated list.
+func queryValues(q map[string][]string, name string) []string {
+	var values []string
+	for _, v := range q[name] {
+		for _, s := range strings.Split(v, ",") {
+			if s != "" {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values, vs []string) bool {
+	for _, v := range vs {
+		if contains(values, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/gsangwell/pbspro_exporter/collector"
+)
+
+// testAPIHandler returns an API handler of two PBS servers, hpc2 failing.
+func testAPIHandler() *apiHandler {
+	h := &handler{servers: []collector.PBSServer{{Name: "hpc1", Address: "10.0.0.1"}, {Name: "hpc2", Address: "10.0.0.2"}}}
+	hpc1 := collector.NewState(h.servers[0], time.Unix(1500000000, 0),
+		[]qstat.QstatServerInfo{{ServerName: "pbs1", TotalJobs: 3}},
+		[]qstat.QstatQueueInfo{{QueueName: "workq"}, {QueueName: "gpu"}},
+		[]qstat.QstatNodeInfo{{NodeName: "n1", State: "free"}, {NodeName: "n2", State: "down,offline"}, {NodeName: "n3", State: "job-busy"}},
+		[]qstat.QstatJobsInfo{
+			{JobName: "a", JobOwner: "alice@login1", Queue: "workq", JobState: "R", VariableList: "SECRET=1"},
+			{JobName: "b", JobOwner: "bob@login1", Queue: "workq", JobState: "Q"},
+			{JobName: "c", JobOwner: "alice@login1", Queue: "gpu", JobState: "Q"},
+		})
+	for _, job := range []struct{ id, owner, name string }{
+		{"1.pbs1", "alice@login1", "a"}, {"2.pbs1", "bob@login1", "b"}, {"3.pbs1", "alice@login1", "c"},
+	} {
+		hpc1.JobAttributes = append(hpc1.JobAttributes, utils.BatchStatus{Name: job.id, Attributes: []utils.Attrib{
+			{Name: "Job_Owner", Value: job.owner},
+			{Name: "Job_Name", Value: job.name},
+			{Name: "ctime", Value: "0"},
+		}})
+	}
+	return &apiHandler{
+		handler: h,
+		state: func(server collector.PBSServer) (*collector.State, error) {
+			if server.Name == "hpc2" {
+				return nil, errors.New("connection refused")
+			}
+			return hpc1, nil
+		},
+	}
+}
+
+type testAPIResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		Items  []map[string]interface{} `json:"items"`
+		Total  int                      `json:"total"`
+		Offset int                      `json:"offset"`
+		Limit  int                      `json:"limit"`
+	} `json:"data"`
+	Error    string   `json:"error"`
+	Warnings []string `json:"warnings"`
+}
+
+func getAPI(t *testing.T, url string) (int, testAPIResponse) {
+	w := httptest.NewRecorder()
+	testAPIHandler().ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	var resp testAPIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: %s: %s", url, err, w.Body)
+	}
+	return w.Code, resp
+}
+
+// names returns the values of key in the items.
+func names(items []map[string]interface{}, key string) string {
+	var names []string
+	for _, item := range items {
+		names = append(names, item[key].(string))
+	}
+	return strings.Join(names, ",")
+}
+
+func TestAPI(t *testing.T) {
+	for _, test := range []struct {
+		url, key, want string
+		total          int
+	}{
+		{"/api/v1/server", "server_name", "pbs1", 1},
+		{"/api/v1/queues", "queue_name", "workq,gpu", 2},
+		{"/api/v1/queues?cluster=hpc1&limit=1&offset=1", "queue_name", "gpu", 2},
+		{"/api/v1/nodes?state=offline,free", "node_name", "n1,n2", 2},
+		{"/api/v1/nodes?offset=5", "node_name", "", 3},
+		{"/api/v1/jobs?user=alice", "job_name", "a,c", 2},
+		{"/api/v1/jobs?user=alice", "job_id", "1.pbs1,3.pbs1", 2},
+		{"/api/v1/jobs?state=Q&queue=workq", "job_name", "b", 1},
+		{"/api/v1/jobs?state=R&state=Q&limit=2", "job_name", "a,b", 3},
+	} {
+		code, resp := getAPI(t, test.url)
+		if code != http.StatusOK || resp.Status != "success" {
+			t.Errorf("%s: got %d %+v", test.url, code, resp)
+			continue
+		}
+		if got := names(resp.Data.Items, test.key); got != test.want || resp.Data.Total != test.total {
+			t.Errorf("%s: got %s of %d, want %s of %d", test.url, got, resp.Data.Total, test.want, test.total)
+		}
+		if !strings.Contains(test.url, "cluster=hpc1") && (len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "hpc2")) {
+			t.Errorf("%s: got warnings %v, want the failing cluster", test.url, resp.Warnings)
+		}
+		for _, item := range resp.Data.Items {
+			if item["cluster"] != "hpc1" {
+				t.Errorf("%s: got cluster %v", test.url, item["cluster"])
+			}
+		}
+	}
+}
+
+func TestAPIRedaction(t *testing.T) {
+	_, resp := getAPI(t, "/api/v1/jobs")
+	for _, job := range resp.Data.Items {
+		if job["variable_list"] != "" || job["job_owner"] == "alice@login1" {
+			t.Errorf("job not redacted: %v", job)
+		}
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	for _, test := range []struct {
+		url  string
+		code int
+	}{
+		{"/api/v1/pods", http.StatusNotFound},
+		{"/api/v1/jobs?limit=-1", http.StatusBadRequest},
+		{"/api/v1/jobs?limit=100000", http.StatusBadRequest},
+		{"/api/v1/jobs?offset=x", http.StatusBadRequest},
+		{"/api/v1/jobs?cluster=hpc3", http.StatusNotFound},
+		{"/api/v1/jobs?cluster=hpc2", http.StatusServiceUnavailable},
+	} {
+		code, resp := getAPI(t, test.url)
+		if code != test.code || resp.Status != "error" || resp.Error == "" {
+			t.Errorf("%s: got %d %+v, want %d", test.url, code, resp, test.code)
+		}
+	}
+}
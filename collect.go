@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gsangwell/pbspro_exporter/collector"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Output formats of the collect command.
+const (
+	formatText        = "text"
+	formatOpenMetrics = "openmetrics"
+)
+
+// runCollect runs the enabled collectors of every server once and writes
+// the metrics to output, or to stdout if output is "-". The metrics are
+// written even if collectors failed, in which case an error naming them is
+// returned.
+func runCollect(servers []collector.PBSServer, output, format string) error {
+	r, err := newRegistry(servers, nil, collector.NewPBSCollector)
+	if err != nil {
+		return err
+	}
+	mfs, gatherErr := r.Gather()
+
+	write := func(w io.Writer) error {
+		if format == formatOpenMetrics {
+			return writeOpenMetrics(w, mfs)
+		}
+		for _, mf := range mfs {
+			if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if output == "-" {
+		w := bufio.NewWriter(os.Stdout)
+		if err := write(w); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	} else if err := writeFileAtomic(output, write); err != nil {
+		return err
+	}
+
+	if gatherErr != nil {
+		return fmt.Errorf("couldn't gather metrics: %s", gatherErr)
+	}
+	if failed := failedCollectors(mfs); len(failed) > 0 {
+		return fmt.Errorf("collectors failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// failedCollectors returns the collectors whose collector_success metric is
+// 0, as <cluster>/<collector>.
+func failedCollectors(mfs []*dto.MetricFamily) []string {
+	var failed []string
+	for _, mf := range mfs {
+		if mf.GetName() != "pbspro_scrape_collector_success" {
+			continue
+		}
+		for _, m := range mf.Metric {
+			if m.GetGauge().GetValue() != 0 {
+				continue
+			}
+			var cluster, name string
+			for _, l := range m.Label {
+				switch l.GetName() {
+				case "cluster":
+					cluster = l.GetValue()
+				case "collector":
+					name = l.GetValue()
+				}
+			}
+			failed = append(failed, cluster+"/"+name)
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// writeFileAtomic writes a file with write and renames it into place, so
+// readers such as the node_exporter textfile collector never see a partial
+// file.
+func writeFileAtomic(filename string, write func(io.Writer) error) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+base+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// writeOpenMetrics writes the metric families in the OpenMetrics text
+// format.
+func writeOpenMetrics(w io.Writer, mfs []*dto.MetricFamily) error {
+	for _, mf := range mfs {
+		name := mf.GetName()
+		typ := "unknown"
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			// OpenMetrics names the family without the _total suffix
+			// of its samples.
+			name = strings.TrimSuffix(name, "_total")
+			typ = "counter"
+		case dto.MetricType_GAUGE:
+			typ = "gauge"
+		case dto.MetricType_SUMMARY:
+			typ = "summary"
+		case dto.MetricType_HISTOGRAM:
+			typ = "histogram"
+		}
+		if mf.Help != nil {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n", name, escapeOpenMetrics(mf.GetHelp())); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", name, typ); err != nil {
+			return err
+		}
+		for _, m := range mf.Metric {
+			if err := writeOpenMetricsSamples(w, name, mf.GetType(), m); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := io.WriteString(w, "# EOF\n")
+	return err
+}
+
+func writeOpenMetricsSamples(w io.Writer, name string, typ dto.MetricType, m *dto.Metric) error {
+	sample := func(suffix string, v float64, extraName, extraValue string) error {
+		_, err := fmt.Fprintf(w, "%s%s%s %s\n", name, suffix, openMetricsLabels(m.Label, extraName, extraValue), formatOpenMetricsValue(v))
+		return err
+	}
+	switch typ {
+	case dto.MetricType_COUNTER:
+		return sample("_total", m.GetCounter().GetValue(), "", "")
+	case dto.MetricType_GAUGE:
+		return sample("", m.GetGauge().GetValue(), "", "")
+	case dto.MetricType_SUMMARY:
+		s := m.GetSummary()
+		for _, q := range s.Quantile {
+			if err := sample("", q.GetValue(), "quantile", formatOpenMetricsValue(q.GetQuantile())); err != nil {
+				return err
+			}
+		}
+		if err := sample("_sum", s.GetSampleSum(), "", ""); err != nil {
+			return err
+		}
+		return sample("_count", float64(s.GetSampleCount()), "", "")
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		infSeen := false
+		for _, b := range h.Bucket {
+			if math.IsInf(b.GetUpperBound(), +1) {
+				infSeen = true
+			}
+			if err := sample("_bucket", float64(b.GetCumulativeCount()), "le", formatOpenMetricsValue(b.GetUpperBound())); err != nil {
+				return err
+			}
+		}
+		if !infSeen {
+			if err := sample("_bucket", float64(h.GetSampleCount()), "le", "+Inf"); err != nil {
+				return err
+			}
+		}
+		if err := sample("_sum", h.GetSampleSum(), "", ""); err != nil {
+			return err
+		}
+		return sample("_count", float64(h.GetSampleCount()), "", "")
+	default:
+		return sample("", m.GetUntyped().GetValue(), "", "")
+	}
+}
+
+func openMetricsLabels(labels []*dto.LabelPair, extraName, extraValue string) string {
+	if len(labels) == 0 && extraName == "" {
+		return ""
+	}
+	var pairs []string
+	for _, l := range labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l.GetName(), escapeOpenMetrics(l.GetValue())))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var openMetricsEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeOpenMetrics(s string) string {
+	return openMetricsEscaper.Replace(s)
+}
+
+func formatOpenMetricsValue(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
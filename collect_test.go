@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	r := prometheus.NewRegistry()
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Requests."}, []string{"path"})
+	c.WithLabelValues(`/a"b`).Add(2)
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "ratio", Help: "A\nratio."})
+	g.Set(0.5)
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "duration_seconds", Help: "Duration.", Buckets: []float64{1}})
+	h.Observe(0.1)
+	h.Observe(3)
+	r.MustRegister(c, g, h)
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeOpenMetrics(&buf, mfs); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="1"} 1
+duration_seconds_bucket{le="+Inf"} 2
+duration_seconds_sum 3.1
+duration_seconds_count 2
+# HELP ratio A\nratio.
+# TYPE ratio gauge
+ratio 0.5
+# HELP requests Requests.
+# TYPE requests counter
+requests_total{path="/a\"b"} 2
+# EOF
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFailedCollectors(t *testing.T) {
+	r := prometheus.NewRegistry()
+	success := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pbspro_scrape_collector_success", Help: "Success."}, []string{"cluster", "collector"})
+	success.WithLabelValues("hpc1", "qstat").Set(1)
+	success.WithLabelValues("hpc2", "server").Set(0)
+	success.WithLabelValues("hpc2", "qstat").Set(0)
+	r.MustRegister(success)
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := failedCollectors(mfs), []string{"hpc2/qstat", "hpc2/server"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pbspro_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "pbspro.prom")
+
+	if err := writeFileAtomic(filename, func(w io.Writer) error {
+		_, err := io.WriteString(w, "up 1\n")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(filename, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return io.ErrShortWrite
+	}); err == nil {
+		t.Fatal("expected write error")
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "up 1\n" {
+		t.Errorf("got %q, want the first write", data)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("temporary files left in %s: %d files", dir, len(files))
+	}
+}
+
+// failingSnapshot is a snapshot for --pbs.replay-dir of a PBS server whose
+// node stat fails.
+const failingSnapshot = `{
+  "server": "pbs1",
+  "time": "2023-11-14T22:13:20Z",
+  "calls": ["server_state", "queue_state", "node_state", "jobs_state",
+    "server_attributes", "queue_attributes", "node_attributes", "job_attributes"],
+  "servers": [{"server_name": "pbs1", "server_state": 1}],
+  "errors": {"node_state": {"code": 15010, "message": "Server could not connect to MOM"}}
+}
+`
+
+func TestCollectExitStatus(t *testing.T) {
+	if args := os.Getenv("PBSPRO_EXPORTER_MAIN_ARGS"); args != "" {
+		// Run as the exporter in the process started below.
+		os.Args = append([]string{"pbspro_exporter"}, strings.Split(args, " ")...)
+		main()
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "pbspro_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	replayDir := filepath.Join(dir, "replay")
+	if err := os.Mkdir(replayDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(replayDir, "pbs1.json"), []byte(failingSnapshot), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "pbspro.prom")
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCollectExitStatus$")
+	cmd.Env = append(os.Environ(), "PBSPRO_EXPORTER_MAIN_ARGS=collect --collector.pbspro.url=pbs1=pbs1 --pbs.replay-dir="+replayDir+" --output="+output)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if e, ok := err.(*exec.ExitError); !ok || e.Success() {
+		t.Fatalf("expected collect to exit non-zero, got %v:\n%s", err, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "pbs1/qstat") {
+		t.Errorf("expected the failed qstat collector to be named:\n%s", stderr.String())
+	}
+
+	// The metrics are written even though a collector failed.
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `pbspro_scrape_collector_success{cluster="pbs1",collector="qstat"} 0`; !strings.Contains(string(data), want) {
+		t.Errorf("expected %s in:\n%s", want, data)
+	}
+}
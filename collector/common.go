@@ -2,23 +2,60 @@ package collector
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/siddontang/go/log"
+	"github.com/prometheus/common/log"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
 const (
-	namespace               = "pbspro"
-	qstatCollectorSubSystem = "qstat"
+	namespace                = "pbspro"
+	qstatCollectorSubSystem  = "qstat"
+	serverCollectorSubSystem = "server"
+	jobCollectorSubSystem    = "job"
+	nodeCollectorSubSystem   = "node"
 )
 
 var (
-	pbsproURL = kingpin.Flag("collector.pbspro.url", "PBSpro Server IP Address").Default("127.0.0.1").String()
+	pbsproURLs = kingpin.Flag("collector.pbspro.url", "PBSpro Server IP Address, optionally as <name>=<address>. Repeat to scrape several servers.").Default("127.0.0.1").Strings()
 )
 
+// PBSServer is a PBS server scraped by the exporter. Name is used as the
+// cluster label on all metrics of the server.
+type PBSServer struct {
+	Name    string
+	Address string
+	// Probe is set for ad-hoc /probe targets, which are not recorded in
+	// the scrape status or by server in the request metrics.
+	Probe bool
+}
+
+// Servers returns the PBS servers given with --collector.pbspro.url.
+func Servers() ([]PBSServer, error) {
+	var servers []PBSServer
+	names := make(map[string]bool)
+	for _, url := range *pbsproURLs {
+		server := PBSServer{Name: url, Address: url}
+		if i := strings.Index(url, "="); i >= 0 {
+			server.Name, server.Address = url[:i], url[i+1:]
+		}
+		if server.Name == "" || server.Address == "" {
+			return nil, fmt.Errorf("invalid PBS server %q, expected [<name>=]<address>", url)
+		}
+		if names[server.Name] {
+			return nil, fmt.Errorf("duplicate PBS server name %q", server.Name)
+		}
+		names[server.Name] = true
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
 var (
 	scrapeDurationDesc = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "scrape", "collector_duration_seconds"),
@@ -40,11 +77,17 @@ const (
 )
 
 var (
-	factories      = make(map[string]func() (Collector, error))
+	factories      = make(map[string]func(server PBSServer, logger log.Logger) (Collector, error))
 	collectorState = make(map[string]*bool)
+
+	// collectorOverrides enable or disable collectors regardless of their
+	// flag. They are set from the configuration file and can change on
+	// reload.
+	overridesMtx       sync.RWMutex
+	collectorOverrides = make(map[string]bool)
 )
 
-func registerCollector(collector string, isDefaultEnabled bool, factory func() (Collector, error)) {
+func registerCollector(collector string, isDefaultEnabled bool, factory func(server PBSServer, logger log.Logger) (Collector, error)) {
 	var helpDefaultState string
 	if isDefaultEnabled {
 		helpDefaultState = "enabled"
@@ -62,76 +105,295 @@ func registerCollector(collector string, isDefaultEnabled bool, factory func() (
 	factories[collector] = factory
 }
 
+// SetCollectorOverrides enables or disables the named collectors,
+// overriding their --collector.<name> flag. Collectors missing from
+// overrides fall back to their flag.
+func SetCollectorOverrides(overrides map[string]bool) error {
+	o, err := copyOverrides(overrides)
+	if err != nil {
+		return err
+	}
+
+	overridesMtx.Lock()
+	defer overridesMtx.Unlock()
+	collectorOverrides = o
+	return nil
+}
+
+// copyOverrides checks that the overridden collectors exist and returns a
+// copy of overrides.
+func copyOverrides(overrides map[string]bool) (map[string]bool, error) {
+	for name := range overrides {
+		if _, exist := collectorState[name]; !exist {
+			return nil, fmt.Errorf("missing collector: %s", name)
+		}
+	}
+	o := make(map[string]bool, len(overrides))
+	for name, enabled := range overrides {
+		o[name] = enabled
+	}
+	return o, nil
+}
+
+// Settings are the collector overrides and the redaction policy of the
+// configuration file. A reload validates them with NewSettings before
+// anything changes, and replaces both at once with ApplySettings.
+type Settings struct {
+	overrides map[string]bool
+	redactor  *redactor
+}
+
+// NewSettings validates the collector overrides and compiles the redaction
+// policy without applying them.
+func NewSettings(overrides map[string]bool, policy Redaction) (*Settings, error) {
+	o, err := copyOverrides(overrides)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRedactor(policy)
+	if err != nil {
+		return nil, err
+	}
+	return &Settings{overrides: o, redactor: r}, nil
+}
+
+// ApplySettings replaces the collector overrides and the redaction policy.
+func ApplySettings(s *Settings) {
+	overridesMtx.Lock()
+	defer overridesMtx.Unlock()
+	redactorMtx.Lock()
+	defer redactorMtx.Unlock()
+	collectorOverrides = s.overrides
+	currentRedactor = s.redactor
+}
+
+// NewPBSCollector is like the package NewPBSCollector, but enables the
+// collectors and redacts the job labels the way the settings do, so that a
+// PBSCollector can be built before the settings are applied, or with
+// settings that are never applied, e.g. those of a /probe module.
+func (s *Settings) NewPBSCollector(server PBSServer, logger log.Logger, filters ...string) (*PBSCollector, error) {
+	return newPBSCollector(server, logger, func(name string) bool {
+		return enabledWith(s.overrides, name)
+	}, s.redactor, filters...)
+}
+
+// NewProbeCollector is like the package NewProbeCollector with the
+// collectors and the redaction of the settings.
+func (s *Settings) NewProbeCollector(server PBSServer, logger log.Logger, filters ...string) (*PBSCollector, error) {
+	server.Probe = true
+	return s.NewPBSCollector(server, logger, filters...)
+}
+
+// Collectors returns the sorted names of all collectors.
+func Collectors() []string {
+	var names []string
+	for name := range collectorState {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckLabels returns an error if one of labels is already a label of the
+// metrics of a collector, so the metrics couldn't be exposed with it.
+func CheckLabels(labels map[string]string) error {
+	c, err := newPBSCollector(PBSServer{}, log.Base(), func(string) bool { return true }, nil)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r := prometheus.WrapRegistererWith(prometheus.Labels{name: labels[name]}, prometheus.NewRegistry())
+		if err := r.Register(c); err != nil {
+			return fmt.Errorf("label %q is already used by the metrics", name)
+		}
+	}
+	return nil
+}
+
+// CollectorExists reports whether a collector of that name is registered.
+func CollectorExists(name string) bool {
+	_, exist := collectorState[name]
+	return exist
+}
+
+func isEnabled(name string) bool {
+	overridesMtx.RLock()
+	defer overridesMtx.RUnlock()
+	return enabledWith(collectorOverrides, name)
+}
+
+// enabledWith reports whether a collector is enabled by overrides or, if it
+// has no override, by its flag.
+func enabledWith(overrides map[string]bool, name string) bool {
+	if enabled, ok := overrides[name]; ok {
+		return enabled
+	}
+	return *collectorState[name]
+}
+
+// EnabledCollectors returns the sorted names of the enabled collectors.
+func EnabledCollectors() []string {
+	var names []string
+	for name := range collectorState {
+		if isEnabled(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // PBSCollector implements the prometheus.Collector interface.
 type PBSCollector struct {
+	Server     PBSServer
 	Collectors map[string]Collector
+	logger     log.Logger
+}
+
+// NewPBSCollector creates a new PBSCollector for the given PBS server. Its
+// collectors log to logger with server and collector fields.
+func NewPBSCollector(server PBSServer, logger log.Logger, filters ...string) (*PBSCollector, error) {
+	return newPBSCollector(server, logger, isEnabled, nil, filters...)
 }
 
-// NewPBSCollector creates a new PBSCollector.
-func NewPBSCollector(filters ...string) (*PBSCollector, error) {
+// redactingCollector is a Collector exposing job labels, which can be
+// redacted with another policy than the current one.
+type redactingCollector interface {
+	Collector
+	setRedactor(r *redactor)
+}
+
+// newPBSCollector creates the collectors isEnabled enables. Unless redactor
+// is nil, they redact the job labels with it instead of the current policy.
+func newPBSCollector(server PBSServer, logger log.Logger, isEnabled func(name string) bool, redactor *redactor, filters ...string) (*PBSCollector, error) {
+	logger = logger.With("server", server.Name)
 	f := make(map[string]bool)
 	for _, filter := range filters {
-		enabled, exist := collectorState[filter]
-		if !exist {
+		if !CollectorExists(filter) {
 			return nil, fmt.Errorf("missing collector: %s", filter)
 		}
-		if !*enabled {
+		if !isEnabled(filter) {
 			return nil, fmt.Errorf("disabled collector: %s", filter)
 		}
 		f[filter] = true
 	}
 	collectors := make(map[string]Collector)
-	for key, enabled := range collectorState {
-		if *enabled {
-			collector, err := factories[key]()
+	for key := range collectorState {
+		if isEnabled(key) {
+			collector, err := factories[key](server, logger.With("collector", key))
 			if err != nil {
 				return nil, err
 			}
+			if rc, ok := collector.(redactingCollector); ok && redactor != nil {
+				rc.setRedactor(redactor)
+			}
 			if len(f) == 0 || f[key] {
 				collectors[key] = collector
 			}
 		}
 	}
-	return &PBSCollector{Collectors: collectors}, nil
+	return &PBSCollector{Server: server, Collectors: collectors, logger: logger}, nil
 }
 
+// NewProbeCollector creates a PBSCollector for an ad-hoc probe target. Unlike
+// the configured servers, its scrapes are neither recorded for the status
+// page nor rate limited in the log, and its PBS API calls are counted under
+// the server label "probe".
+func NewProbeCollector(server PBSServer, logger log.Logger, filters ...string) (*PBSCollector, error) {
+	server.Probe = true
+	return NewPBSCollector(server, logger, filters...)
+}
+
+// Describe implements the prometheus.Collector interface. It sends the
+// descriptors of every metric the collectors may emit.
 func (n PBSCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	for _, c := range n.Collectors {
+		c.Describe(ch)
+	}
 }
 
-// Collect implements the prometheus.Collector interface.
+// Collect implements the prometheus.Collector interface. The collectors
+// share one connection and the objects they read from PBS. If they read the
+// whole state of a configured server, it is kept for CurrentState.
 func (n PBSCollector) Collect(ch chan<- prometheus.Metric) {
+	src := newScrapeSource(n.Server)
 	wg := sync.WaitGroup{}
 	wg.Add(len(n.Collectors))
 	for name, c := range n.Collectors {
 		go func(name string, c Collector) {
-			execute(name, c, ch)
+			execute(n.Server, name, c, src, ch, n.logger.With("collector", name))
 			wg.Done()
 		}(name, c)
 	}
 	wg.Wait()
+
+	if err := src.close(); err != nil {
+		n.logger.Debugln("Couldn't disconnect from PBS:", err)
+	}
+	if state := src.state(); state != nil && !n.Server.Probe {
+		storeState(state)
+	}
+}
+
+// inFlight counts the collector runs in progress.
+var inFlight int64
+
+// InFlight returns the number of collector runs in progress. Every run
+// disconnects from PBS when it returns.
+func InFlight() int {
+	return int(atomic.LoadInt64(&inFlight))
 }
 
-func execute(name string, c Collector, ch chan<- prometheus.Metric) {
+// execute runs the collector. Unless the server is a probe target, its
+// outcome is recorded in the scrape status and its errors are rate limited.
+func execute(server PBSServer, name string, c Collector, src pbsSource, ch chan<- prometheus.Metric, logger log.Logger) {
+	record := !server.Probe
+	atomic.AddInt64(&inFlight, 1)
+	defer atomic.AddInt64(&inFlight, -1)
+
 	begin := time.Now()
-	err := c.Update(ch)
+	err := c.Update(src, ch)
 	duration := time.Since(begin)
 	var success float64
 
-	if err != nil {
-		log.Errorf("ERROR: %s collector failed after %fs: %s", name, duration.Seconds(), err)
+	logger = logger.With("duration_seconds", duration.Seconds())
+	if err != nil && !record {
+		logger.Errorln("Collector failed:", err)
+		success = 0
+	} else if err != nil {
+		if suppressed, ok := errorLimiter.allow(server.Name, name, err); ok {
+			if suppressed > 0 {
+				logger = logger.With("suppressed", suppressed)
+			}
+			logger.Errorln("Collector failed:", err)
+		}
 		success = 0
 	} else {
-		log.Debugf("OK: %s collector succeeded after %fs.", name, duration.Seconds())
+		if record {
+			errorLimiter.reset(server.Name, name)
+		}
+		logger.Debugln("Collector succeeded")
 		success = 1
 	}
+	if record {
+		recordScrape(ScrapeStatus{Server: server.Name, Collector: name, Time: begin, Duration: duration, Err: err})
+	}
 	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
 	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
 }
 
 // Collector is the interface a collector has to implement.
 type Collector interface {
-	// Get new metrics and expose them via prometheus registry.
-	Update(ch chan<- prometheus.Metric) error
+	// Describe sends the descriptors of all metrics Update may send.
+	Describe(ch chan<- *prometheus.Desc)
+	// Get new metrics from src and expose them via prometheus registry.
+	// src is shared by the collectors of a scrape and closed after them.
+	Update(src pbsSource, ch chan<- prometheus.Metric) error
 }
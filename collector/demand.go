@@ -0,0 +1,146 @@
+package collector
+
+import (
+	"sort"
+
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// demandStates are the job states the queue demand is summed for, with the
+// value of their state label.
+var demandStates = []struct{ code, name string }{
+	{"Q", "queued"},
+	{"H", "held"},
+	{"R", "running"},
+}
+
+// queueDemand is what the jobs of a queue in a state requested.
+type queueDemand struct {
+	ncpus, nodes, ngpus float64
+	// cpuSeconds is walltime×ncpus.
+	cpuSeconds float64
+}
+
+// demandMetrics returns what the queued, held and running jobs of every queue
+// requested, and how long the queue takes to drain on the schedulable CPUs
+// of its nodes.
+func demandMetrics(jobs, nodes []utils.BatchStatus) []qstatMetric {
+	demand := make(map[string]map[string]*queueDemand)
+	// work is the CPU time left to the queued and running jobs.
+	work := make(map[string]float64)
+	for _, job := range jobs {
+		state := attribute(job.Attributes, "job_state")
+		queue := attribute(job.Attributes, "queue")
+		var name string
+		for _, s := range demandStates {
+			if s.code == state {
+				name = s.name
+			}
+		}
+		if name == "" || queue == "" {
+			continue
+		}
+		byState, ok := demand[queue]
+		if !ok {
+			byState = make(map[string]*queueDemand)
+			demand[queue] = byState
+		}
+		d, ok := byState[name]
+		if !ok {
+			d = &queueDemand{}
+			byState[name] = d
+		}
+
+		// Jobs whose select can't be parsed still count with their
+		// job-wide resources.
+		req, _ := jobRequested(job.Attributes)
+		if req == nil {
+			req = &jobRequest{}
+		}
+		ncpus := requestedResource(job.Attributes, "ncpus", req.resources.get("ncpus"))
+		walltime, _ := parseResourceValue(resourceAttribute(job.Attributes, "Resource_List", "walltime"))
+		d.ncpus += ncpus
+		d.nodes += requestedResource(job.Attributes, "nodect", req.chunks)
+		d.ngpus += requestedResource(job.Attributes, "ngpus", req.resources.get("ngpus"))
+		d.cpuSeconds += walltime * ncpus
+
+		switch state {
+		case "Q":
+			work[queue] += walltime * ncpus
+		case "R":
+			used, _ := parseResourceValue(resourceAttribute(job.Attributes, "resources_used", "walltime"))
+			if walltime > used {
+				work[queue] += (walltime - used) * ncpus
+			}
+		}
+	}
+
+	var queues []string
+	for queue := range demand {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+
+	capacity := queueCapacity(nodes)
+	var metrics []qstatMetric
+	gauge := func(name string, v float64, labels []string, values ...string) {
+		metrics = append(metrics, qstatMetric{
+			name:            name,
+			value:           v,
+			metricType:      prometheus.GaugeValue,
+			extraLabel:      labels,
+			extraLabelValue: values,
+		})
+	}
+	for _, queue := range queues {
+		for _, s := range demandStates {
+			d := demand[queue][s.name]
+			if d == nil {
+				d = &queueDemand{}
+			}
+			gauge("queue_requested_ncpus", d.ncpus, demandLabels, queue, s.name)
+			gauge("queue_requested_nodes", d.nodes, demandLabels, queue, s.name)
+			gauge("queue_requested_ngpus", d.ngpus, demandLabels, queue, s.name)
+			gauge("queue_requested_core_hours", d.cpuSeconds/3600, demandLabels, queue, s.name)
+		}
+		if ncpus := capacity(queue); ncpus > 0 {
+			gauge("queue_drain_seconds", work[queue]/ncpus, []string{"queue"}, queue)
+		}
+	}
+	return metrics
+}
+
+// requestedResource returns the job-wide Resource_List.<name>, which PBS sums
+// from the select, or fallback, taken from the select, if the job has none.
+func requestedResource(attribs []utils.Attrib, name string, fallback float64) float64 {
+	if v, ok := parseResourceValue(resourceAttribute(attribs, "Resource_List", name)); ok {
+		return v
+	}
+	return fallback
+}
+
+// queueCapacity returns a function giving the ncpus of the schedulable nodes
+// a queue runs on: the nodes associated with the queue, or the nodes
+// associated with no queue if there are none.
+func queueCapacity(nodes []utils.BatchStatus) func(queue string) float64 {
+	byQueue := make(map[string]float64)
+	for _, node := range nodes {
+		if nodeStateClass(attribute(node.Attributes, "state")) != schedulableClass {
+			// Associated nodes that are down still keep the queue off the
+			// unassociated nodes.
+			if q := attribute(node.Attributes, "queue"); q != "" {
+				byQueue[q] += 0
+			}
+			continue
+		}
+		ncpus, _ := parseResourceValue(resourceAttribute(node.Attributes, "resources_available", "ncpus"))
+		byQueue[attribute(node.Attributes, "queue")] += ncpus
+	}
+	return func(queue string) float64 {
+		if ncpus, ok := byQueue[queue]; ok {
+			return ncpus
+		}
+		return byQueue[""]
+	}
+}
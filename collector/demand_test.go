@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/gsangwell/go_pbspro/utils"
+)
+
+func TestDemandMetrics(t *testing.T) {
+	job := func(state, queue string, attribs ...utils.Attrib) utils.BatchStatus {
+		return utils.BatchStatus{Attributes: append([]utils.Attrib{
+			{Name: "job_state", Value: state},
+			{Name: "queue", Value: queue},
+		}, attribs...)}
+	}
+	rl := func(resource, value string) utils.Attrib {
+		return utils.Attrib{Name: "Resource_List", Resource: resource, Value: value}
+	}
+	jobs := []utils.BatchStatus{
+		job("Q", "workq", rl("ncpus", "32"), rl("nodect", "2"), rl("select", "2:ncpus=16"), rl("walltime", "02:00:00")),
+		// Without job-wide resources, the select is summed.
+		job("Q", "workq", rl("select", "3:ncpus=2:ngpus=1"), rl("walltime", "01:00:00")),
+		job("H", "workq", rl("ncpus", "8"), rl("nodect", "1"), rl("walltime", "10:00:00")),
+		job("R", "workq", rl("ncpus", "16"), rl("nodect", "1"), rl("walltime", "04:00:00"),
+			utils.Attrib{Name: "resources_used", Resource: "walltime", Value: "03:00:00"}),
+		job("R", "gpu", rl("ncpus", "4"), rl("ngpus", "2"), rl("nodect", "1"), rl("walltime", "01:00:00")),
+		job("E", "workq", rl("ncpus", "64")),
+	}
+	node := func(state, queue, ncpus string) utils.BatchStatus {
+		return utils.BatchStatus{Attributes: []utils.Attrib{
+			{Name: "state", Value: state},
+			{Name: "queue", Value: queue},
+			{Name: "resources_available", Resource: "ncpus", Value: ncpus},
+		}}
+	}
+	nodes := []utils.BatchStatus{
+		node("free", "", "32"),
+		node("job-busy", "", "16"),
+		node("down", "", "64"),
+		node("down", "gpu", "8"),
+	}
+
+	got := make(map[string]float64)
+	for _, m := range demandMetrics(jobs, nodes) {
+		got[fmt.Sprintf("%s%v", m.name, m.extraLabelValue)] = m.value
+	}
+	want := map[string]float64{
+		"queue_requested_ncpus[gpu queued]":         0,
+		"queue_requested_nodes[gpu queued]":         0,
+		"queue_requested_ngpus[gpu queued]":         0,
+		"queue_requested_core_hours[gpu queued]":    0,
+		"queue_requested_ncpus[gpu held]":           0,
+		"queue_requested_nodes[gpu held]":           0,
+		"queue_requested_ngpus[gpu held]":           0,
+		"queue_requested_core_hours[gpu held]":      0,
+		"queue_requested_ncpus[gpu running]":        4,
+		"queue_requested_nodes[gpu running]":        1,
+		"queue_requested_ngpus[gpu running]":        2,
+		"queue_requested_core_hours[gpu running]":   4,
+		"queue_requested_ncpus[workq queued]":       38,
+		"queue_requested_nodes[workq queued]":       5,
+		"queue_requested_ngpus[workq queued]":       3,
+		"queue_requested_core_hours[workq queued]":  70,
+		"queue_requested_ncpus[workq held]":         8,
+		"queue_requested_nodes[workq held]":         1,
+		"queue_requested_ngpus[workq held]":         0,
+		"queue_requested_core_hours[workq held]":    80,
+		"queue_requested_ncpus[workq running]":      16,
+		"queue_requested_nodes[workq running]":      1,
+		"queue_requested_ngpus[workq running]":      0,
+		"queue_requested_core_hours[workq running]": 64,
+		// 70 queued and 16 running core-hours left on 48 CPUs. The
+		// gpu queue has no schedulable node.
+		"queue_drain_seconds[workq]": 86 * 3600 / 48,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// estimateMetrics returns the estimated start and the wait left of the queued
+// jobs the scheduler estimated a start for, and per queue the earliest
+// estimated start. Estimates are only made with the scheduler's estimation
+// enabled, e.g. with strict_ordering and backfill_depth.
+//
+// The earliest estimate of a queue is not necessarily the one of the job the
+// scheduler considers next: that order depends on the job sort formula and
+// fairshare, which the job attributes don't tell.
+func estimateMetrics(jobs []utils.BatchStatus, now time.Time) []qstatMetric {
+	var metrics []qstatMetric
+	earliest := make(map[string]time.Time)
+	for _, job := range jobs {
+		if attribute(job.Attributes, "job_state") != "Q" {
+			continue
+		}
+		start, err := strconv.ParseInt(resourceAttribute(job.Attributes, "estimated", "start_time"), 10, 64)
+		if err != nil {
+			continue
+		}
+		t := time.Unix(start, 0)
+
+		wait := t.Sub(now).Seconds()
+		if wait < 0 {
+			// The scheduler didn't run the job when it expected to.
+			wait = 0
+		}
+		metrics = append(metrics, qstatMetric{
+			name:            "estimated_start_time_seconds",
+			value:           float64(start),
+			metricType:      prometheus.GaugeValue,
+			extraLabel:      []string{"job_id"},
+			extraLabelValue: []string{job.Name},
+		}, qstatMetric{
+			name:            "estimated_wait_seconds",
+			value:           wait,
+			metricType:      prometheus.GaugeValue,
+			extraLabel:      []string{"job_id"},
+			extraLabelValue: []string{job.Name},
+		})
+
+		queue := attribute(job.Attributes, "queue")
+		if e, ok := earliest[queue]; !ok || t.Before(e) {
+			earliest[queue] = t
+		}
+	}
+
+	var queues []string
+	for queue := range earliest {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+	for _, queue := range queues {
+		metrics = append(metrics, qstatMetric{
+			name:            "queue_earliest_estimated_start_time_seconds",
+			value:           float64(earliest[queue].Unix()),
+			metricType:      prometheus.GaugeValue,
+			extraLabel:      []string{"queue"},
+			extraLabelValue: []string{queue},
+		})
+	}
+	return metrics
+}
@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/utils"
+)
+
+func TestEstimateMetrics(t *testing.T) {
+	job := func(name, state, queue, start string) utils.BatchStatus {
+		attribs := []utils.Attrib{
+			{Name: "job_state", Value: state},
+			{Name: "queue", Value: queue},
+		}
+		if start != "" {
+			attribs = append(attribs, utils.Attrib{Name: "estimated", Resource: "start_time", Value: start})
+		}
+		return utils.BatchStatus{Name: name, Attributes: attribs}
+	}
+	jobs := []utils.BatchStatus{
+		job("1.pbs1", "Q", "workq", "1700003600"),
+		job("2.pbs1", "Q", "workq", "1700007200"),
+		job("3.pbs1", "Q", "workq", "1700005400"),
+		// The estimate of a job that isn't queued anymore is stale.
+		job("4.pbs1", "R", "workq", "1700000000"),
+		job("5.pbs1", "Q", "workq", ""),
+		job("6.pbs1", "Q", "gpu", "1699999000"),
+	}
+
+	got := make(map[string]float64)
+	for _, m := range estimateMetrics(jobs, time.Unix(1700000000, 0)) {
+		got[fmt.Sprintf("%s%v", m.name, m.extraLabelValue)] = m.value
+	}
+	want := map[string]float64{
+		"estimated_start_time_seconds[1.pbs1]":               1700003600,
+		"estimated_wait_seconds[1.pbs1]":                     3600,
+		"estimated_start_time_seconds[2.pbs1]":               1700007200,
+		"estimated_wait_seconds[2.pbs1]":                     7200,
+		"estimated_start_time_seconds[3.pbs1]":               1700005400,
+		"estimated_wait_seconds[3.pbs1]":                     5400,
+		"estimated_start_time_seconds[6.pbs1]":               1699999000,
+		"estimated_wait_seconds[6.pbs1]":                     0,
+		"queue_earliest_estimated_start_time_seconds[workq]": 1700003600,
+		"queue_earliest_estimated_start_time_seconds[gpu]":   1699999000,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
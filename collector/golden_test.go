@@ -0,0 +1,193 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// fixture is a snapshot of a PBS cluster read from testdata/fixtures.
+type fixture struct {
+	Servers       []qstat.QstatServerInfo `json:"servers"`
+	Queues        []qstat.QstatQueueInfo  `json:"queues"`
+	Nodes         []qstat.QstatNodeInfo   `json:"nodes"`
+	Jobs          []qstat.QstatJobsInfo   `json:"jobs"`
+	ServerAttribs []utils.BatchStatus     `json:"server_attributes"`
+	QueueAttribs  []utils.BatchStatus     `json:"queue_attributes"`
+	NodeAttribs   []utils.BatchStatus     `json:"node_attributes"`
+	JobAttribs    []utils.BatchStatus     `json:"job_attributes"`
+	// Errors are returned by the calls they are keyed by, e.g.
+	// node_state, instead of the state.
+	Errors map[string]string `json:"errors"`
+}
+
+func (f *fixture) err(call string) error {
+	if msg, ok := f.Errors[call]; ok {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+func (f *fixture) ServerState() ([]qstat.QstatServerInfo, error) {
+	if err := f.err("server_state"); err != nil {
+		return nil, err
+	}
+	return f.Servers, nil
+}
+
+func (f *fixture) QueueState() ([]qstat.QstatQueueInfo, error) {
+	if err := f.err("queue_state"); err != nil {
+		return nil, err
+	}
+	return f.Queues, nil
+}
+
+func (f *fixture) NodeState() ([]qstat.QstatNodeInfo, error) {
+	if err := f.err("node_state"); err != nil {
+		return nil, err
+	}
+	return f.Nodes, nil
+}
+
+func (f *fixture) JobsState() ([]qstat.QstatJobsInfo, error) {
+	if err := f.err("jobs_state"); err != nil {
+		return nil, err
+	}
+	return f.Jobs, nil
+}
+
+func (f *fixture) ServerAttributes() ([]utils.BatchStatus, error) {
+	if err := f.err("server_attributes"); err != nil {
+		return nil, err
+	}
+	return f.ServerAttribs, nil
+}
+
+func (f *fixture) QueueAttributes() ([]utils.BatchStatus, error) {
+	if err := f.err("queue_attributes"); err != nil {
+		return nil, err
+	}
+	return f.QueueAttribs, nil
+}
+
+func (f *fixture) NodeAttributes() ([]utils.BatchStatus, error) {
+	if err := f.err("node_attributes"); err != nil {
+		return nil, err
+	}
+	return f.NodeAttribs, nil
+}
+
+func (f *fixture) JobAttributes() ([]utils.BatchStatus, error) {
+	if err := f.err("job_attributes"); err != nil {
+		return nil, err
+	}
+	return f.JobAttribs, nil
+}
+
+func (f *fixture) Close() error { return nil }
+
+func loadFixture(t *testing.T, name string) *fixture {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "fixtures", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := new(fixture)
+	if err := json.Unmarshal(data, f); err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	return f
+}
+
+// scrape runs every collector against the sources opened with open through a PBSCollector registered
+// the way the exporter does, and returns the text exposition. The collector
+// durations are left out as they change on every run.
+func scrape(t *testing.T, open func(PBSServer) (pbsSource, error)) []byte {
+	withOpen(t, open)
+
+	server := PBSServer{Name: "pbs1", Address: "pbs1.example.com"}
+	c := &PBSCollector{Server: server, Collectors: make(map[string]Collector), logger: log.NewNopLogger()}
+	for name, factory := range factories {
+		collector, err := factory(server, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Collectors[name] = collector
+	}
+
+	r := prometheus.NewPedanticRegistry()
+	if err := prometheus.WrapRegistererWith(prometheus.Labels{"cluster": server.Name}, r).Register(c); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		if mf.GetName() == prometheus.BuildFQName(namespace, "scrape", "collector_duration_seconds") {
+			continue
+		}
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// TestGolden compares the exposition of every fixture with its golden file.
+// Run with -update to regenerate the golden files after a deliberate change
+// and review the diff.
+func TestGolden(t *testing.T) {
+	for _, name := range []string{"small", "large", "degraded", "empty", "failing"} {
+		t.Run(name, func(t *testing.T) {
+			f := loadFixture(t, name)
+			got := scrape(t, func(PBSServer) (pbsSource, error) { return f, nil })
+
+			golden := filepath.Join("testdata", name+".prom")
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("exposition differs from %s, run go test -update and review the diff", golden)
+			}
+		})
+	}
+}
+
+// TestStatErrorsFailScrape checks that a failed stat call fails the qstat
+// collector while the sections that succeeded are still exported.
+func TestStatErrorsFailScrape(t *testing.T) {
+	f := loadFixture(t, "failing")
+	got := scrape(t, func(PBSServer) (pbsSource, error) { return f, nil })
+	for _, want := range []string{
+		`pbspro_scrape_collector_success{cluster="pbs1",collector="qstat"} 0`,
+		`pbspro_qstat_server_state{`,
+		`pbspro_qstat_queue_total_jobs{`,
+	} {
+		if !bytes.Contains(got, []byte(want)) {
+			t.Errorf("exposition lacks %s", want)
+		}
+	}
+	if bytes.Contains(got, []byte("pbspro_qstat_node_pcpus{")) {
+		t.Error("nodes exported although their stat failed")
+	}
+}
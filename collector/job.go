@@ -0,0 +1,302 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+func init() {
+	registerCollector(jobCollectorSubSystem, defaultEnabled, NewJobCollector)
+}
+
+// Label names of the job metrics, in the order of their values.
+var (
+	allocationLabels = []string{"job_id", "node", "resource"}
+	requestLabels    = []string{"job_id", "resource"}
+	placeLabels      = []string{"job_id", "arrangement", "sharing", "group"}
+	demandLabels     = []string{"queue", "state"}
+)
+
+// jobMetricDefs are the metrics of the job collector, labelled by job id
+// rather than by the job attributes, for joins with other metrics.
+var jobMetricDefs = defineMetrics(jobCollectorSubSystem,
+	metricDef{"node_allocation", "pbspro_exporter: Resources allocated to a job on a node, from exec_vnode. mem is in bytes.", allocationLabels},
+	metricDef{"requested_chunks", "pbspro_exporter: Chunks requested by a job in Resource_List.select.", []string{"job_id"}},
+	metricDef{"requested_resource", "pbspro_exporter: Resources requested by a job, summed over the chunks of Resource_List.select. Sizes are in bytes.", requestLabels},
+	metricDef{"place_info", "pbspro_exporter: Placement requested by a job in Resource_List.place.", placeLabels},
+	metricDef{"queue_requested_ncpus", "pbspro_exporter: CPUs requested by the queued, held and running jobs of a queue.", demandLabels},
+	metricDef{"queue_requested_nodes", "pbspro_exporter: Nodes requested by the queued, held and running jobs of a queue.", demandLabels},
+	metricDef{"queue_requested_ngpus", "pbspro_exporter: GPUs requested by the queued, held and running jobs of a queue.", demandLabels},
+	metricDef{"queue_requested_core_hours", "pbspro_exporter: Walltime times ncpus requested by the queued, held and running jobs of a queue, in hours.", demandLabels},
+	metricDef{"estimated_start_time_seconds", "pbspro_exporter: Start of a queued job estimated by the scheduler, in seconds since the epoch.", []string{"job_id"}},
+	metricDef{"estimated_wait_seconds", "pbspro_exporter: Time left until the start of a queued job estimated by the scheduler.", []string{"job_id"}},
+	metricDef{"queue_earliest_estimated_start_time_seconds", "pbspro_exporter: Earliest estimated start of the queued jobs of a queue, in seconds since the epoch.", []string{"queue"}},
+	metricDef{"queue_drain_seconds", "pbspro_exporter: Estimated time to run the queued jobs and finish the running jobs of a queue on the schedulable CPUs of its nodes.", []string{"queue"}},
+)
+
+// allocationResources are the resources of the node_allocation metric.
+var allocationResources = map[string]bool{"ncpus": true, "mem": true, "ngpus": true}
+
+type jobCollector struct {
+	server PBSServer
+	logger log.Logger
+	// now returns the time the estimated waits are relative to.
+	now func() time.Time
+}
+
+// NewJobCollector returns a collector exporting where the jobs run.
+func NewJobCollector(server PBSServer, logger log.Logger) (Collector, error) {
+	return &jobCollector{server: server, logger: logger, now: time.Now}, nil
+}
+
+func (c *jobCollector) Describe(ch chan<- *prometheus.Desc) {
+	jobMetricDefs.describe(ch)
+}
+
+func (c *jobCollector) Update(src pbsSource, ch chan<- prometheus.Metric) error {
+	jobs, err := src.JobAttributes()
+	if err != nil {
+		return fmt.Errorf("stat jobs: %s", err)
+	}
+	nodes, err := src.NodeAttributes()
+	if err != nil {
+		return fmt.Errorf("stat nodes: %s", err)
+	}
+	metrics := allocationMetrics(jobs, c.logger)
+	metrics = append(metrics, requestMetrics(jobs, c.logger)...)
+	metrics = append(metrics, demandMetrics(jobs, nodes)...)
+	metrics = append(metrics, estimateMetrics(jobs, c.now())...)
+	return jobMetricDefs.send(ch, metrics)
+}
+
+// allocationMetrics returns the resources allocated to the jobs per node.
+// Jobs whose exec_vnode can't be parsed are left out.
+func allocationMetrics(jobs []utils.BatchStatus, logger log.Logger) []qstatMetric {
+	var metrics []qstatMetric
+	for _, job := range jobs {
+		allocs, err := jobAllocations(job.Attributes)
+		if err != nil {
+			logger.Warnf("Parse allocation of job %s failed. %s", job.Name, err)
+			continue
+		}
+		for _, a := range allocs {
+			for _, r := range a.resources {
+				if !allocationResources[r.name] {
+					continue
+				}
+				metrics = append(metrics, qstatMetric{
+					name:            "node_allocation",
+					value:           r.value,
+					metricType:      prometheus.GaugeValue,
+					extraLabel:      allocationLabels,
+					extraLabelValue: []string{job.Name, a.node, r.name},
+				})
+			}
+		}
+	}
+	return metrics
+}
+
+// requestMetrics returns the resources requested by the jobs and their
+// placement. Jobs whose select or place can't be parsed are left out.
+func requestMetrics(jobs []utils.BatchStatus, logger log.Logger) []qstatMetric {
+	var metrics []qstatMetric
+	for _, job := range jobs {
+		req, err := jobRequested(job.Attributes)
+		if err != nil {
+			logger.Warnf("Parse request of job %s failed. %s", job.Name, err)
+			continue
+		}
+		if req == nil {
+			continue
+		}
+		metrics = append(metrics, qstatMetric{
+			name:            "requested_chunks",
+			value:           req.chunks,
+			metricType:      prometheus.GaugeValue,
+			extraLabel:      []string{"job_id"},
+			extraLabelValue: []string{job.Name},
+		}, qstatMetric{
+			name:            "place_info",
+			value:           1,
+			metricType:      prometheus.GaugeValue,
+			extraLabel:      placeLabels,
+			extraLabelValue: []string{job.Name, req.place.arrangement, req.place.sharing, req.place.group},
+		})
+		for _, r := range req.resources {
+			metrics = append(metrics, qstatMetric{
+				name:            "requested_resource",
+				value:           r.value,
+				metricType:      prometheus.GaugeValue,
+				extraLabel:      requestLabels,
+				extraLabelValue: []string{job.Name, r.name},
+			})
+		}
+	}
+	return metrics
+}
+
+// jobRequested returns what a job requested in Resource_List.select and
+// place, or nil if it has no select.
+func jobRequested(attribs []utils.Attrib) (*jobRequest, error) {
+	sel := resourceAttribute(attribs, "Resource_List", "select")
+	if sel == "" {
+		return nil, nil
+	}
+	chunks, resources, err := parseSelect(sel)
+	if err != nil {
+		return nil, err
+	}
+	place, err := parsePlace(resourceAttribute(attribs, "Resource_List", "place"))
+	if err != nil {
+		return nil, err
+	}
+	return &jobRequest{chunks: chunks, resources: resources, place: place}, nil
+}
+
+// resourceAttribute returns the value of the resource of an attribute, e.g.
+// Resource_List.select.
+func resourceAttribute(attribs []utils.Attrib, name, resource string) string {
+	for _, attr := range attribs {
+		if attr.Name == name && attr.Resource == resource {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// nodeAllocation is what a job was allocated on a node.
+type nodeAllocation struct {
+	node      string
+	resources resourceSums
+}
+
+type allocatedResource struct {
+	name  string
+	value float64
+}
+
+// resourceSums are amounts of resources, in the order they appeared in.
+type resourceSums []allocatedResource
+
+// add adds v to the resource.
+func (r *resourceSums) add(name string, v float64) {
+	for i := range *r {
+		if (*r)[i].name == name {
+			(*r)[i].value += v
+			return
+		}
+	}
+	*r = append(*r, allocatedResource{name, v})
+}
+
+// get returns the amount of the resource, 0 if there is none.
+func (r resourceSums) get(name string) float64 {
+	for _, res := range r {
+		if res.name == name {
+			return res.value
+		}
+	}
+	return 0
+}
+
+// jobAllocations returns the allocation of a job from exec_vnode, or the
+// ncpus from exec_host if the job has no exec_vnode.
+func jobAllocations(attribs []utils.Attrib) ([]nodeAllocation, error) {
+	if v := attribute(attribs, "exec_vnode"); v != "" {
+		return parseExecVnode(v)
+	}
+	if h := attribute(attribs, "exec_host"); h != "" {
+		return parseExecHost(h)
+	}
+	return nil, nil
+}
+
+// parseExecVnode parses an exec_vnode such as
+// (n1:ncpus=8:mem=32gb)+(n2[0]:ncpus=4+n2[1]:ncpus=4) into the resources per
+// node. Vnodes named <host>[<index>] count for their host, so that the node
+// is the host other exporters run on. Sizes are in bytes.
+func parseExecVnode(s string) ([]nodeAllocation, error) {
+	var (
+		allocs []nodeAllocation
+		depth  int
+	)
+	for _, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth < 0 || depth > 1 {
+			return nil, fmt.Errorf("unbalanced parentheses in %q", s)
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses in %q", s)
+	}
+
+	spec := strings.NewReplacer("(", "", ")", "").Replace(s)
+	for _, vnode := range strings.Split(spec, "+") {
+		fields := strings.Split(vnode, ":")
+		name := strings.TrimSpace(fields[0])
+		if name == "" {
+			return nil, fmt.Errorf("missing vnode name in %q", s)
+		}
+		if i := strings.Index(name, "["); i > 0 && strings.HasSuffix(name, "]") {
+			name = name[:i]
+		}
+		a := allocation(&allocs, name)
+		for _, f := range fields[1:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("invalid resource %q in %q", f, s)
+			}
+			v, ok := parseResourceValue(kv[1])
+			if !ok {
+				// String resources can't be summed.
+				continue
+			}
+			a.resources.add(kv[0], v)
+		}
+	}
+	return allocs, nil
+}
+
+// parseExecHost parses an exec_host such as n1/0*8+n2/0*8 into the ncpus
+// per host. A host without *<ncpus> has one CPU.
+func parseExecHost(s string) ([]nodeAllocation, error) {
+	var allocs []nodeAllocation
+	for _, h := range strings.Split(s, "+") {
+		i := strings.Index(h, "/")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid host %q in %q", h, s)
+		}
+		ncpus := float64(1)
+		if j := strings.Index(h, "*"); j > i {
+			n, ok := parseResourceValue(h[j+1:])
+			if !ok {
+				return nil, fmt.Errorf("invalid ncpus in %q", h)
+			}
+			ncpus = n
+		}
+		allocation(&allocs, h[:i]).resources.add("ncpus", ncpus)
+	}
+	return allocs, nil
+}
+
+// allocation returns the allocation of a node, appending it if needed.
+func allocation(allocs *[]nodeAllocation, node string) *nodeAllocation {
+	for i := range *allocs {
+		if (*allocs)[i].node == node {
+			return &(*allocs)[i]
+		}
+	}
+	*allocs = append(*allocs, nodeAllocation{node: node})
+	return &(*allocs)[len(*allocs)-1]
+}
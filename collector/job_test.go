@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/prometheus/common/log"
+)
+
+func TestParseExecVnode(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want []nodeAllocation
+	}{
+		{"(n1:ncpus=8:mem=32gb)+(n2:ncpus=8)", []nodeAllocation{
+			{"n1", []allocatedResource{{"ncpus", 8}, {"mem", 32 << 30}}},
+			{"n2", []allocatedResource{{"ncpus", 8}}},
+		}},
+		{"(n1[0]:ncpus=4:ngpus=1+n1[1]:ncpus=4:ngpus=1)+(n1[0]:mem=1gb)", []nodeAllocation{
+			{"n1", []allocatedResource{{"ncpus", 8}, {"ngpus", 2}, {"mem", 1 << 30}}},
+		}},
+		{"(n1:ncpus=2:arch=linux)", []nodeAllocation{
+			{"n1", []allocatedResource{{"ncpus", 2}}},
+		}},
+		{"n1:ncpus=1", []nodeAllocation{
+			{"n1", []allocatedResource{{"ncpus", 1}}},
+		}},
+	} {
+		got, err := parseExecVnode(test.in)
+		if err != nil {
+			t.Errorf("%s: %s", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.in, got, test.want)
+		}
+	}
+
+	for _, in := range []string{"(n1:ncpus=8", "((n1:ncpus=8))", "(:ncpus=8)", "(n1:ncpus)", "(n1:ncpus=1)+"} {
+		if _, err := parseExecVnode(in); err == nil {
+			t.Errorf("%s: expected error", in)
+		}
+	}
+}
+
+func TestParseExecHost(t *testing.T) {
+	got, err := parseExecHost("n1/0*8+n2/0*8+n2/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []nodeAllocation{
+		{"n1", []allocatedResource{{"ncpus", 8}}},
+		{"n2", []allocatedResource{{"ncpus", 9}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, in := range []string{"n1", "/0*8", "n1/0*x"} {
+		if _, err := parseExecHost(in); err == nil {
+			t.Errorf("%s: expected error", in)
+		}
+	}
+}
+
+func TestAllocationMetrics(t *testing.T) {
+	jobs := []utils.BatchStatus{
+		{Name: "1.pbs1", Attributes: []utils.Attrib{{Name: "exec_host", Value: "n1/0*8"}, {Name: "exec_vnode", Value: "(n1:ncpus=8:mem=4gb:ngpus=1:foo=2)"}}},
+		{Name: "2.pbs1", Attributes: []utils.Attrib{{Name: "exec_host", Value: "n2/0*2"}}},
+		{Name: "3.pbs1", Attributes: []utils.Attrib{{Name: "exec_vnode", Value: "(n3:ncpus=8"}}},
+		{Name: "4.pbs1"},
+	}
+	var got []string
+	for _, m := range allocationMetrics(jobs, log.NewNopLogger()) {
+		got = append(got, m.extraLabelValue[0]+" "+m.extraLabelValue[1]+" "+m.extraLabelValue[2])
+	}
+	want := []string{"1.pbs1 n1 ncpus", "1.pbs1 n1 mem", "1.pbs1 n1 ngpus", "2.pbs1 n2 ncpus"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	jobs := []utils.BatchStatus{
+		{Name: "1.pbs1", Attributes: []utils.Attrib{
+			{Name: "Resource_List", Resource: "ncpus", Value: "32"},
+			{Name: "Resource_List", Resource: "place", Value: "scatter:excl"},
+			{Name: "Resource_List", Resource: "select", Value: "2:ncpus=16:ngpus=1"},
+		}},
+		{Name: "2.pbs1", Attributes: []utils.Attrib{{Name: "Resource_List", Resource: "select", Value: "1:ncpus=1:ncpus=2"}}},
+		{Name: "3.pbs1", Attributes: []utils.Attrib{{Name: "Resource_List", Resource: "select", Value: "1:ncpus=1"}, {Name: "Resource_List", Resource: "place", Value: "wide"}}},
+		{Name: "4.pbs1"},
+	}
+	var got []string
+	for _, m := range requestMetrics(jobs, log.NewNopLogger()) {
+		got = append(got, fmt.Sprintf("%s %v %v", m.name, m.extraLabelValue, m.value))
+	}
+	want := []string{
+		"requested_chunks [1.pbs1] 2",
+		"place_info [1.pbs1 scatter excl ] 1",
+		"requested_resource [1.pbs1 ncpus] 32",
+		"requested_resource [1.pbs1 ngpus] 2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,158 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gsangwell/go_pbspro/utils"
+)
+
+// pbsLimit is a single entry of a PBS limit attribute. A new-style attribute
+// such as max_run = "[o:PBS_ALL=100],[u:PBS_GENERIC=10],[u:alice=20]" yields
+// one pbsLimit per bracketed entry.
+type pbsLimit struct {
+	// attribute is the name of the limit attribute, e.g. max_run_res.
+	attribute string
+	// resource is set for the *_res limits, e.g. ncpus for max_run_res.ncpus.
+	resource string
+	// entityType is one of overall, user, group or project.
+	entityType string
+	// entity is PBS_ALL, PBS_GENERIC or a user, group or project name.
+	entity string
+	value  float64
+}
+
+// newStyleLimits are the limit attributes that take the
+// [<type>:<entity>=<value>] syntax.
+var newStyleLimits = map[string]bool{
+	"max_run":                   true,
+	"max_run_soft":              true,
+	"max_run_res":               true,
+	"max_run_res_soft":          true,
+	"max_queued":                true,
+	"max_queued_res":            true,
+	"queued_jobs_threshold":     true,
+	"queued_jobs_threshold_res": true,
+}
+
+// oldStyleLimits are the deprecated limit attributes which take a plain
+// value. They are mapped onto the entity they implicitly apply to.
+var oldStyleLimits = map[string]struct{ entityType, entity string }{
+	"max_running":        {"overall", "PBS_ALL"},
+	"max_queuable":       {"overall", "PBS_ALL"},
+	"max_user_run":       {"user", "PBS_GENERIC"},
+	"max_user_run_soft":  {"user", "PBS_GENERIC"},
+	"max_user_res":       {"user", "PBS_GENERIC"},
+	"max_user_res_soft":  {"user", "PBS_GENERIC"},
+	"max_group_run":      {"group", "PBS_GENERIC"},
+	"max_group_run_soft": {"group", "PBS_GENERIC"},
+	"max_group_res":      {"group", "PBS_GENERIC"},
+	"max_group_res_soft": {"group", "PBS_GENERIC"},
+}
+
+var limitEntityTypes = map[string]string{
+	"o": "overall",
+	"u": "user",
+	"g": "group",
+	"p": "project",
+}
+
+// isLimitAttribute reports whether name is a PBS limit attribute.
+func isLimitAttribute(name string) bool {
+	_, old := oldStyleLimits[name]
+	return newStyleLimits[name] || old
+}
+
+// parseLimits parses a limit attribute as returned by pbs_statque or
+// pbs_statserver. A plain value on a new-style attribute is treated as an
+// overall limit, which is how PBS itself interprets it.
+func parseLimits(attr utils.Attrib) ([]pbsLimit, error) {
+	value := strings.TrimSpace(attr.Value)
+
+	if old, ok := oldStyleLimits[attr.Name]; ok {
+		v, ok := parseResourceValue(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s value %q", attr.Name, value)
+		}
+		return []pbsLimit{{
+			attribute:  attr.Name,
+			resource:   attr.Resource,
+			entityType: old.entityType,
+			entity:     old.entity,
+			value:      v,
+		}}, nil
+	}
+
+	if !newStyleLimits[attr.Name] {
+		return nil, fmt.Errorf("%s is not a limit attribute", attr.Name)
+	}
+
+	if !strings.HasPrefix(value, "[") {
+		v, ok := parseResourceValue(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s value %q", attr.Name, value)
+		}
+		return []pbsLimit{{
+			attribute:  attr.Name,
+			resource:   attr.Resource,
+			entityType: "overall",
+			entity:     "PBS_ALL",
+			value:      v,
+		}}, nil
+	}
+
+	var limits []pbsLimit
+	for _, entry := range splitLimitEntries(value) {
+		l, err := parseLimitEntry(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q: %s", attr.Name, entry, err)
+		}
+		l.attribute = attr.Name
+		l.resource = attr.Resource
+		limits = append(limits, l)
+	}
+	return limits, nil
+}
+
+// splitLimitEntries splits "[o:PBS_ALL=10],[u:bob=2]" into its bracketed
+// entries, without the brackets.
+func splitLimitEntries(s string) []string {
+	var entries []string
+	for _, part := range strings.Split(s, "]") {
+		part = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(part), ","))
+		if part == "" {
+			continue
+		}
+		entries = append(entries, strings.TrimPrefix(part, "["))
+	}
+	return entries
+}
+
+// parseLimitEntry parses a single "<type>:<entity>=<value>" entry.
+func parseLimitEntry(entry string) (pbsLimit, error) {
+	var l pbsLimit
+
+	colon := strings.Index(entry, ":")
+	eq := strings.LastIndex(entry, "=")
+	if colon < 0 || eq < colon {
+		return l, fmt.Errorf("expected <type>:<entity>=<value>")
+	}
+
+	entityType, ok := limitEntityTypes[strings.TrimSpace(entry[:colon])]
+	if !ok {
+		return l, fmt.Errorf("unknown entity type %q", entry[:colon])
+	}
+	entity := strings.TrimSpace(entry[colon+1 : eq])
+	if entity == "" {
+		return l, fmt.Errorf("missing entity")
+	}
+	v, ok := parseResourceValue(entry[eq+1:])
+	if !ok {
+		return l, fmt.Errorf("invalid value %q", entry[eq+1:])
+	}
+
+	l.entityType = entityType
+	l.entity = entity
+	l.value = v
+	return l, nil
+}
@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gsangwell/go_pbspro/utils"
+)
+
+func TestParseLimits(t *testing.T) {
+	for _, test := range []struct {
+		attr utils.Attrib
+		want []pbsLimit
+	}{
+		{utils.Attrib{Name: "max_run", Value: "[u:PBS_GENERIC=10]"}, []pbsLimit{
+			{"max_run", "", "user", "PBS_GENERIC", 10},
+		}},
+		{utils.Attrib{Name: "max_run_res", Resource: "ncpus", Value: "[o:PBS_ALL=256]"}, []pbsLimit{
+			{"max_run_res", "ncpus", "overall", "PBS_ALL", 256},
+		}},
+		{utils.Attrib{Name: "max_queued_res", Resource: "mem", Value: "[g:grp=5gb]"}, []pbsLimit{
+			{"max_queued_res", "mem", "group", "grp", 5 << 30},
+		}},
+		{utils.Attrib{Name: "max_run", Value: "[o:PBS_ALL=100],[u:PBS_GENERIC=10], [u:alice=20],[p:proj=3]"}, []pbsLimit{
+			{"max_run", "", "overall", "PBS_ALL", 100},
+			{"max_run", "", "user", "PBS_GENERIC", 10},
+			{"max_run", "", "user", "alice", 20},
+			{"max_run", "", "project", "proj", 3},
+		}},
+		// A plain value on a new-style attribute is an overall limit.
+		{utils.Attrib{Name: "max_run", Value: "50"}, []pbsLimit{
+			{"max_run", "", "overall", "PBS_ALL", 50},
+		}},
+		{utils.Attrib{Name: "max_user_run", Value: "4"}, []pbsLimit{
+			{"max_user_run", "", "user", "PBS_GENERIC", 4},
+		}},
+		{utils.Attrib{Name: "max_group_res", Resource: "walltime", Value: "10:00:00"}, []pbsLimit{
+			{"max_group_res", "walltime", "group", "PBS_GENERIC", 36000},
+		}},
+	} {
+		got, err := parseLimits(test.attr)
+		if err != nil {
+			t.Errorf("%+v: %s", test.attr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: got %+v, want %+v", test.attr, got, test.want)
+		}
+	}
+
+	for _, attr := range []utils.Attrib{
+		{Name: "max_run", Value: "[x:PBS_ALL=1]"},
+		{Name: "max_run", Value: "[u:=1]"},
+		{Name: "max_run", Value: "[u:alice]"},
+		{Name: "max_run", Value: "[u:alice=many]"},
+		{Name: "max_run", Value: "[u:alice=inf]"},
+		{Name: "max_run", Value: "[o:PBS_ALL=1],[uPBS_GENERIC=2]"},
+		{Name: "max_run", Value: "lots"},
+		{Name: "max_user_run", Value: "[u:PBS_GENERIC=1]"},
+		{Name: "queue_type", Value: "Execution"},
+	} {
+		if _, err := parseLimits(attr); err == nil {
+			t.Errorf("%+v: expected error", attr)
+		}
+	}
+}
+
+func TestParseLimitEntry(t *testing.T) {
+	for entry, want := range map[string]pbsLimit{
+		"u:PBS_GENERIC=10": {entityType: "user", entity: "PBS_GENERIC", value: 10},
+		"o:PBS_ALL=1gb":    {entityType: "overall", entity: "PBS_ALL", value: 1 << 30},
+		" g : grp = 5":     {entityType: "group", entity: "grp", value: 5},
+		"p:a=b=2":          {entityType: "project", entity: "a=b", value: 2},
+	} {
+		got, err := parseLimitEntry(entry)
+		if err != nil {
+			t.Errorf("%q: %s", entry, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: got %+v, want %+v", entry, got, want)
+		}
+	}
+	for _, entry := range []string{"", "u", "u:alice", "=1", "alice=1:u", "z:alice=1", "u: =1", "u:alice=x"} {
+		if _, err := parseLimitEntry(entry); err == nil {
+			t.Errorf("%q: expected error", entry)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+var errorLogInterval = kingpin.Flag("collector.error-log-interval", "Log a repeated collector error at most once per interval.").Default("1m").Duration()
+
+// errorLimiter rate limits the error logs of failing collectors, so a PBS
+// server that is down does not log an error on every scrape.
+var errorLimiter = newLogLimiter(func() time.Duration { return *errorLogInterval })
+
+type limitedError struct {
+	msg        string
+	logged     time.Time
+	suppressed int
+}
+
+type logLimiter struct {
+	interval func() time.Duration
+	now      func() time.Time
+
+	mtx    sync.Mutex
+	errors map[[2]string]*limitedError
+}
+
+func newLogLimiter(interval func() time.Duration) *logLimiter {
+	return &logLimiter{
+		interval: interval,
+		now:      time.Now,
+		errors:   make(map[[2]string]*limitedError),
+	}
+}
+
+// allow reports whether err of the collector for server should be logged.
+// A new or changed error is always logged; a repeated one once per
+// interval, along with the number of times it was suppressed since.
+func (l *logLimiter) allow(server, collector string, err error) (suppressed int, ok bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	key := [2]string{server, collector}
+	now := l.now()
+	e := l.errors[key]
+	if e != nil && e.msg == err.Error() && now.Sub(e.logged) < l.interval() {
+		e.suppressed++
+		return 0, false
+	}
+	if e != nil && e.msg == err.Error() {
+		suppressed = e.suppressed
+	}
+	l.errors[key] = &limitedError{msg: err.Error(), logged: now}
+	return suppressed, true
+}
+
+// reset forgets the error of a collector that succeeded again.
+func (l *logLimiter) reset(server, collector string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	delete(l.errors, [2]string{server, collector})
+}
+
+// prune forgets the errors of servers whose name is not in names.
+func (l *logLimiter) prune(names map[string]bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	for key := range l.errors {
+		if !names[key[0]] {
+			delete(l.errors, key)
+		}
+	}
+}
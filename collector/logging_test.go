@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLogLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newLogLimiter(func() time.Duration { return time.Minute })
+	l.now = func() time.Time { return now }
+
+	down := errors.New("connection refused")
+	for i, tc := range []struct {
+		advance    time.Duration
+		err        error
+		ok         bool
+		suppressed int
+	}{
+		{err: down, ok: true},
+		{advance: 15 * time.Second, err: down},
+		{advance: 15 * time.Second, err: down},
+		// A different error is logged at once.
+		{advance: time.Second, err: errors.New("timeout"), ok: true},
+		{advance: time.Second, err: errors.New("timeout")},
+		{advance: time.Minute, err: errors.New("timeout"), ok: true, suppressed: 1},
+	} {
+		now = now.Add(tc.advance)
+		suppressed, ok := l.allow("pbs1", "qstat", tc.err)
+		if ok != tc.ok || suppressed != tc.suppressed {
+			t.Errorf("%d: got (%d, %v), want (%d, %v)", i, suppressed, ok, tc.suppressed, tc.ok)
+		}
+	}
+
+	// Other collectors are limited separately.
+	if _, ok := l.allow("pbs1", "server", down); !ok {
+		t.Error("error of another collector was suppressed")
+	}
+
+	// After a success the next error is logged again.
+	l.reset("pbs1", "qstat")
+	if _, ok := l.allow("pbs1", "qstat", errors.New("timeout")); !ok {
+		t.Error("error after reset was suppressed")
+	}
+}
@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricDef declares a metric a collector may emit. Collectors declare all
+// of their metrics up front so that Describe returns every descriptor.
+type metricDef struct {
+	name   string
+	help   string
+	labels []string
+}
+
+// metricDefs are the metric definitions of a collector subsystem with their
+// descriptors, keyed by metric name.
+type metricDefs struct {
+	subsystem string
+	defs      map[string]metricDef
+	descs     map[string]*prometheus.Desc
+}
+
+// allMetricDefs holds the metric definitions of every collector, keyed by
+// subsystem.
+var allMetricDefs = make(map[string]*metricDefs)
+
+// defineMetrics registers the metric definitions of a subsystem. It panics
+// on a duplicate subsystem or metric, which is a programming error.
+func defineMetrics(subsystem string, defs ...metricDef) *metricDefs {
+	if _, ok := allMetricDefs[subsystem]; ok {
+		panic(fmt.Sprintf("metrics of subsystem %s defined twice", subsystem))
+	}
+	d := &metricDefs{
+		subsystem: subsystem,
+		defs:      make(map[string]metricDef),
+		descs:     make(map[string]*prometheus.Desc),
+	}
+	for _, def := range defs {
+		if _, ok := d.defs[def.name]; ok {
+			panic(fmt.Sprintf("metric %s_%s defined twice", subsystem, def.name))
+		}
+		d.defs[def.name] = def
+		d.descs[def.name] = prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, def.name),
+			def.help,
+			def.labels,
+			nil,
+		)
+	}
+	allMetricDefs[subsystem] = d
+	return d
+}
+
+// describe sends the descriptors of all defined metrics.
+func (d *metricDefs) describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range d.descs {
+		ch <- desc
+	}
+}
+
+// send sends the metrics with their defined descriptors. Metrics that are
+// not defined or whose labels differ from the definition are skipped and
+// the first such error is returned.
+func (d *metricDefs) send(ch chan<- prometheus.Metric, metrics []qstatMetric) error {
+	var firstErr error
+	for _, m := range metrics {
+		if err := d.check(m); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		metric, err := prometheus.NewConstMetric(d.descs[m.name], m.metricType, m.value, m.extraLabelValue...)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("metric %s_%s: %s", d.subsystem, m.name, err)
+			}
+			continue
+		}
+		ch <- metric
+	}
+	return firstErr
+}
+
+// check returns an error if m does not match its definition.
+func (d *metricDefs) check(m qstatMetric) error {
+	def, ok := d.defs[m.name]
+	if !ok {
+		return fmt.Errorf("metric %s_%s is not defined", d.subsystem, m.name)
+	}
+	if len(m.extraLabel) != len(def.labels) || len(m.extraLabelValue) != len(def.labels) {
+		return fmt.Errorf("metric %s_%s: got %d label names and %d values, want %d", d.subsystem, m.name, len(m.extraLabel), len(m.extraLabelValue), len(def.labels))
+	}
+	for i, l := range def.labels {
+		if m.extraLabel[i] != l {
+			return fmt.Errorf("metric %s_%s: label %d is %s, want %s", d.subsystem, m.name, i, m.extraLabel[i], l)
+		}
+	}
+	return nil
+}
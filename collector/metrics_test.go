@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-z][a-z0-9_]*[a-z0-9]$`)
+	labelNameRE  = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+)
+
+func TestMetricDefsLint(t *testing.T) {
+	for subsystem, defs := range allMetricDefs {
+		for name, def := range defs.defs {
+			fqName := prometheus.BuildFQName(namespace, subsystem, name)
+			if !metricNameRE.MatchString(name) || strings.Contains(name, "__") {
+				t.Errorf("%s: invalid metric name", fqName)
+			}
+			if strings.HasSuffix(name, "_total") || strings.HasSuffix(name, "_count") && !strings.HasSuffix(name, "state_count") {
+				t.Errorf("%s: gauges must not have a counter suffix", fqName)
+			}
+			if !strings.HasPrefix(def.help, "pbspro_exporter: ") || len(def.help) == len("pbspro_exporter: ") {
+				t.Errorf("%s: help %q must start with \"pbspro_exporter: \"", fqName, def.help)
+			}
+			seen := make(map[string]bool)
+			for _, l := range def.labels {
+				if !labelNameRE.MatchString(l) {
+					t.Errorf("%s: invalid label name %q", fqName, l)
+				}
+				if l == "cluster" {
+					t.Errorf("%s: label cluster is added by the exporter", fqName)
+				}
+				if seen[l] {
+					t.Errorf("%s: duplicate label %s", fqName, l)
+				}
+				seen[l] = true
+			}
+		}
+
+		r := prometheus.NewPedanticRegistry()
+		if err := r.Register(describer{defs}); err != nil {
+			t.Errorf("%s: %s", subsystem, err)
+		}
+	}
+}
+
+// describer registers the descriptors of metric definitions.
+type describer struct {
+	defs *metricDefs
+}
+
+func (d describer) Describe(ch chan<- *prometheus.Desc) { d.defs.describe(ch) }
+func (d describer) Collect(ch chan<- prometheus.Metric) {}
+
+func TestMetricDefsSend(t *testing.T) {
+	ch := make(chan prometheus.Metric, 10)
+	err := qstatMetricDefs.send(ch, []qstatMetric{
+		{name: "jobs_resources_used_cput", value: 1, metricType: prometheus.GaugeValue, extraLabel: jobLabels, extraLabelValue: []string{"1"}},
+		{name: "jobs_undefined", value: 1, metricType: prometheus.GaugeValue},
+		{name: "queue_enable", value: 1, metricType: prometheus.GaugeValue, extraLabel: qstatQueueLabels, extraLabelValue: []string{"workq", "Execution"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "jobs_resources_used_cput") {
+		t.Errorf("expected label count error, got %v", err)
+	}
+	if len(ch) != 1 {
+		t.Errorf("got %d metrics, want 1", len(ch))
+	}
+
+	err = qstatMetricDefs.send(ch, []qstatMetric{
+		{name: "queue_enable", value: 1, metricType: prometheus.GaugeValue, extraLabel: []string{"QueueType", "QueueName"}, extraLabelValue: []string{"workq", "Execution"}},
+	})
+	if err == nil {
+		t.Error("expected label order error")
+	}
+}
+
+// clusterSource has one of every kind of PBS object.
+var clusterSource = &fakeSource{
+	servers: []qstat.QstatServerInfo{{ServerName: "pbs1", ServerHost: "pbs1.example.com", PBSVersion: "19.1.3"}},
+	queues:  []qstat.QstatQueueInfo{{QueueName: "workq", QueueType: "Execution"}},
+	nodes:   []qstat.QstatNodeInfo{{NodeName: "cn001", ResourcesAvailableNcpus: 32}, {NodeName: "cn002", ResourcesAvailableNcpus: 32}},
+	jobs:    []qstat.QstatJobsInfo{secretJob},
+	serverAttrs: []utils.BatchStatus{{Name: "pbs1", Attributes: []utils.Attrib{
+		{Name: "max_run", Value: "[u:PBS_GENERIC=10]"},
+		{Name: "resources_available", Resource: "ncpus", Value: "64"},
+		{Name: "flatuid", Value: "True"},
+		{Name: "acl_host_enable", Value: "False"},
+		{Name: "scheduler_iteration", Value: "600"},
+	}}},
+	queueAttrs: []utils.BatchStatus{{Name: "workq", Attributes: []utils.Attrib{
+		{Name: "Priority", Value: "100"},
+		{Name: "resources_max", Resource: "walltime", Value: "24:00:00"},
+		{Name: "max_run_res", Resource: "ncpus", Value: "[o:PBS_ALL=64]"},
+	}}},
+}
+
+// withSource makes the collectors read from src until the test ends.
+func withSource(t *testing.T, src pbsSource) {
+	withOpen(t, func(PBSServer) (pbsSource, error) { return src, nil })
+}
+
+// withOpen makes the collectors open their sources with open until the test
+// ends.
+func withOpen(t *testing.T, open func(PBSServer) (pbsSource, error)) {
+	orig := newSource
+	newSource = open
+	t.Cleanup(func() { newSource = orig })
+}
+
+func TestCollectorsMatchDescriptors(t *testing.T) {
+	withSource(t, clusterSource)
+
+	server := PBSServer{Name: "pbs1", Address: "pbs1"}
+	c := &PBSCollector{Server: server, Collectors: make(map[string]Collector), logger: log.Base()}
+	for name, factory := range factories {
+		collector, err := factory(server, log.Base())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Collectors[name] = collector
+	}
+	// The pedantic registry fails if a collected metric was not described
+	// or does not match its descriptor.
+	expected := `
+# HELP pbspro_qstat_node_resources_available_ncpus pbspro_exporter: Node Resources Available Ncpus.
+# TYPE pbspro_qstat_node_resources_available_ncpus gauge
+`
+	for _, node := range []string{"cn001", "cn002"} {
+		expected += `pbspro_qstat_node_resources_available_ncpus{Mom="",NodeName="` + node + `",NodeState="",Ntype="",ResourcesAvailableApplications="",ResourcesAvailableArch="",ResourcesAvailableHost="",ResourcesAvailablePlatform="",ResourcesAvailableSoftware="",ResourcesAvailableVnodes="",RunningJobs="",Sharing=""} 32
+`
+	}
+	expected += `# HELP pbspro_scrape_collector_success pbspro_exporter: Whether a collector succeeded.
+# TYPE pbspro_scrape_collector_success gauge
+pbspro_scrape_collector_success{collector="job"} 1
+pbspro_scrape_collector_success{collector="node"} 1
+pbspro_scrape_collector_success{collector="qstat"} 1
+pbspro_scrape_collector_success{collector="server"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"pbspro_qstat_node_resources_available_ncpus", "pbspro_scrape_collector_success"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,178 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func init() {
+	registerCollector(nodeCollectorSubSystem, defaultEnabled, NewNodeCollector)
+}
+
+var nodeGroupBy = kingpin.Flag("collector.node.group-by", "Node attribute to break the cluster capacity down by, e.g. resources_available.host or resources_available.rack.").String()
+
+// Label names of the node metrics, in the order of their values.
+var (
+	nodeCountLabels = []string{"state", "group"}
+	capacityLabels  = []string{"resource", "state", "group"}
+)
+
+// capacityResources are the resources the capacity is summed for.
+var capacityResources = []string{"ncpus", "mem", "ngpus"}
+
+// nodeStateClasses are what the node states are reduced to, see
+// nodeStateClass.
+var nodeStateClasses = []string{schedulableClass, "offline", "down"}
+
+const schedulableClass = "schedulable"
+
+var (
+	// The scheduler doesn't place jobs on stale nodes, which their MoM
+	// no longer reports.
+	nodeDownStates    = map[string]bool{"down": true, "state-unknown": true, "unresolvable": true, "stale": true}
+	nodeOfflineStates = map[string]bool{"offline": true}
+)
+
+// nodeMetricDefs are the cluster totals of the node collector, summed over
+// the nodes so that they don't depend on which nodes are up.
+var nodeMetricDefs = defineMetrics(nodeCollectorSubSystem,
+	metricDef{"nodes", "pbspro_exporter: Nodes by state, schedulable, offline or down.", nodeCountLabels},
+	metricDef{"resources_capacity", "pbspro_exporter: Sum of resources_available of the nodes by state. mem is in bytes.", capacityLabels},
+	metricDef{"resources_assigned", "pbspro_exporter: Sum of resources_assigned of the nodes by state. mem is in bytes.", capacityLabels},
+	metricDef{"resources_unassigned", "pbspro_exporter: Resources of the nodes not assigned to jobs by state. mem is in bytes.", capacityLabels},
+	metricDef{"utilization_ratio", "pbspro_exporter: Assigned over total resources of the nodes by state.", capacityLabels},
+)
+
+type nodeCollector struct {
+	server PBSServer
+	logger log.Logger
+}
+
+// NewNodeCollector returns a collector exporting the capacity of the nodes.
+func NewNodeCollector(server PBSServer, logger log.Logger) (Collector, error) {
+	return &nodeCollector{server: server, logger: logger}, nil
+}
+
+func (c *nodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	nodeMetricDefs.describe(ch)
+}
+
+func (c *nodeCollector) Update(src pbsSource, ch chan<- prometheus.Metric) error {
+	nodes, err := src.NodeAttributes()
+	if err != nil {
+		return fmt.Errorf("stat nodes: %s", err)
+	}
+	return nodeMetricDefs.send(ch, capacityMetrics(nodes, *nodeGroupBy))
+}
+
+// nodeStateClass returns whether a node in the given state, e.g.
+// job-busy or down,offline, is schedulable, offline or down. Down wins over
+// offline, as a down node stays unusable when it is brought back online.
+func nodeStateClass(state string) string {
+	class := schedulableClass
+	for _, s := range strings.Split(state, ",") {
+		switch {
+		case nodeDownStates[s]:
+			return "down"
+		case nodeOfflineStates[s]:
+			class = "offline"
+		}
+	}
+	return class
+}
+
+// nodeCapacity is the capacity of the nodes of a group in a state class.
+type nodeCapacity struct {
+	nodes    float64
+	total    resourceSums
+	assigned resourceSums
+	// free is what isn't assigned, summed per node.
+	free resourceSums
+}
+
+// capacityMetrics returns the capacity of the nodes by state class and by
+// the value of the groupBy attribute, if any. groupBy is an attribute name
+// such as state or a resource such as resources_available.rack.
+func capacityMetrics(nodes []utils.BatchStatus, groupBy string) []qstatMetric {
+	groupName, groupResource := groupBy, ""
+	if i := strings.Index(groupBy, "."); i >= 0 {
+		groupName, groupResource = groupBy[:i], groupBy[i+1:]
+	}
+
+	groups := map[string]map[string]*nodeCapacity{"": {}}
+	if groupBy != "" {
+		groups = map[string]map[string]*nodeCapacity{}
+	}
+	for _, node := range nodes {
+		group := ""
+		if groupBy != "" {
+			group = resourceAttribute(node.Attributes, groupName, groupResource)
+		}
+		byClass, ok := groups[group]
+		if !ok {
+			byClass = make(map[string]*nodeCapacity)
+			groups[group] = byClass
+		}
+		class := nodeStateClass(attribute(node.Attributes, "state"))
+		c, ok := byClass[class]
+		if !ok {
+			c = &nodeCapacity{}
+			byClass[class] = c
+		}
+		c.nodes++
+		for _, r := range capacityResources {
+			total, _ := parseResourceValue(resourceAttribute(node.Attributes, "resources_available", r))
+			assigned, _ := parseResourceValue(resourceAttribute(node.Attributes, "resources_assigned", r))
+			c.total.add(r, total)
+			c.assigned.add(r, assigned)
+			if total > assigned {
+				c.free.add(r, total-assigned)
+			}
+		}
+	}
+
+	var names []string
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+
+	var metrics []qstatMetric
+	gauge := func(name string, v float64, labels []string, values ...string) {
+		metrics = append(metrics, qstatMetric{
+			name:            name,
+			value:           v,
+			metricType:      prometheus.GaugeValue,
+			extraLabel:      labels,
+			extraLabelValue: values,
+		})
+	}
+	for _, group := range names {
+		// Every state class is exported, so that the series of a class
+		// don't go away with its last node.
+		for _, class := range nodeStateClasses {
+			c := groups[group][class]
+			if c == nil {
+				c = &nodeCapacity{}
+			}
+			gauge("nodes", c.nodes, nodeCountLabels, class, group)
+			for _, r := range capacityResources {
+				gauge("resources_capacity", c.total.get(r), capacityLabels, r, class, group)
+				gauge("resources_assigned", c.assigned.get(r), capacityLabels, r, class, group)
+				gauge("resources_unassigned", c.free.get(r), capacityLabels, r, class, group)
+				var ratio float64
+				if total := c.total.get(r); total > 0 {
+					ratio = c.assigned.get(r) / total
+				}
+				gauge("utilization_ratio", ratio, capacityLabels, r, class, group)
+			}
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gsangwell/go_pbspro/utils"
+)
+
+func TestNodeStateClass(t *testing.T) {
+	for state, want := range map[string]string{
+		"free":                  "schedulable",
+		"job-busy":              "schedulable",
+		"job-exclusive,busy":    "schedulable",
+		"offline":               "offline",
+		"job-busy,offline":      "offline",
+		"down":                  "down",
+		"down,offline":          "down",
+		"offline,state-unknown": "down",
+		"stale":                 "down",
+		"job-busy,stale":        "down",
+	} {
+		if got := nodeStateClass(state); got != want {
+			t.Errorf("%s: got %s, want %s", state, got, want)
+		}
+	}
+}
+
+func TestCapacityMetrics(t *testing.T) {
+	node := func(name, state, rack, ncpus, assigned string) utils.BatchStatus {
+		return utils.BatchStatus{Name: name, Attributes: []utils.Attrib{
+			{Name: "state", Value: state},
+			{Name: "resources_available", Resource: "ncpus", Value: ncpus},
+			{Name: "resources_available", Resource: "rack", Value: rack},
+			{Name: "resources_assigned", Resource: "ncpus", Value: assigned},
+		}}
+	}
+	nodes := []utils.BatchStatus{
+		node("n1", "job-busy", "r1", "32", "32"),
+		node("n2", "free", "r1", "32", "8"),
+		node("n3", "down,offline", "r1", "32", "0"),
+		node("n4", "offline", "r2", "64", "16"),
+	}
+
+	got := make(map[string]float64)
+	for _, m := range capacityMetrics(nodes, "resources_available.rack") {
+		if m.name == "nodes" || m.extraLabelValue[0] == "ncpus" {
+			got[fmt.Sprintf("%s%v", m.name, m.extraLabelValue)] = m.value
+		}
+	}
+	want := map[string]float64{
+		"nodes[schedulable r1]":                      2,
+		"nodes[offline r1]":                          0,
+		"nodes[down r1]":                             1,
+		"resources_capacity[ncpus schedulable r1]":   64,
+		"resources_capacity[ncpus offline r1]":       0,
+		"resources_capacity[ncpus down r1]":          32,
+		"resources_assigned[ncpus schedulable r1]":   40,
+		"resources_assigned[ncpus offline r1]":       0,
+		"resources_assigned[ncpus down r1]":          0,
+		"resources_unassigned[ncpus schedulable r1]": 24,
+		"resources_unassigned[ncpus offline r1]":     0,
+		"resources_unassigned[ncpus down r1]":        32,
+		"utilization_ratio[ncpus schedulable r1]":    0.625,
+		"utilization_ratio[ncpus offline r1]":        0,
+		"utilization_ratio[ncpus down r1]":           0,
+		"nodes[schedulable r2]":                      0,
+		"nodes[offline r2]":                          1,
+		"nodes[down r2]":                             0,
+		"resources_capacity[ncpus schedulable r2]":   0,
+		"resources_capacity[ncpus offline r2]":       64,
+		"resources_capacity[ncpus down r2]":          0,
+		"resources_assigned[ncpus schedulable r2]":   0,
+		"resources_assigned[ncpus offline r2]":       16,
+		"resources_assigned[ncpus down r2]":          0,
+		"resources_unassigned[ncpus schedulable r2]": 0,
+		"resources_unassigned[ncpus offline r2]":     48,
+		"resources_unassigned[ncpus down r2]":        0,
+		"utilization_ratio[ncpus schedulable r2]":    0,
+		"utilization_ratio[ncpus offline r2]":        0.25,
+		"utilization_ratio[ncpus down r2]":           0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	var groups []string
+	for _, m := range capacityMetrics(nodes, "") {
+		if m.name == "utilization_ratio" && m.extraLabelValue[0] == "ncpus" {
+			groups = append(groups, fmt.Sprintf("%s %q %v", m.extraLabelValue[1], m.extraLabelValue[2], m.value))
+		}
+	}
+	sort.Strings(groups)
+	if want := []string{`down "" 0`, `offline "" 0.25`, `schedulable "" 0.625`}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("got %v, want %v", groups, want)
+	}
+}
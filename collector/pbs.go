@@ -0,0 +1,169 @@
+package collector
+
+/*
+#cgo CFLAGS: -g
+#cgo LDFLAGS: -L/opt/pbs/lib -lpbs
+#include <stdlib.h>
+#include "/opt/pbs/include/pbs_error.h"
+#include "/opt/pbs/include/pbs_ifl.h"
+*/
+import "C"
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/gsangwell/go_pbspro/utils"
+)
+
+// The typed state gathered by go_pbspro/qstat only covers a fixed set of
+// attributes. The helpers below return the raw batch status of an object so
+// that collectors can look at any attribute the server reports (limits,
+// resources_max, custom resources, ...). They reuse the handle of an already
+// connected qstat.Qstat.
+
+// statServerRaw returns the raw attributes of the server.
+func statServerRaw(handle int) ([]utils.BatchStatus, error) {
+	e := C.CString("")
+	defer C.free(unsafe.Pointer(e))
+
+	bs := C.pbs_statserver(C.int(handle), nil, e)
+	if bs == nil {
+		return nil, statError()
+	}
+	defer C.pbs_statfree(bs)
+
+	return batchStatus(bs), nil
+}
+
+// statQueueRaw returns the raw attributes of all queues, or of the queue
+// named id when id is not empty.
+func statQueueRaw(handle int, id string) ([]utils.BatchStatus, error) {
+	i := C.CString(id)
+	defer C.free(unsafe.Pointer(i))
+
+	e := C.CString("")
+	defer C.free(unsafe.Pointer(e))
+
+	bs := C.pbs_statque(C.int(handle), i, nil, e)
+	if bs == nil {
+		return nil, statError()
+	}
+	defer C.pbs_statfree(bs)
+
+	return batchStatus(bs), nil
+}
+
+// statNodeRaw returns the raw attributes of all nodes.
+func statNodeRaw(handle int) ([]utils.BatchStatus, error) {
+	i := C.CString("")
+	defer C.free(unsafe.Pointer(i))
+
+	e := C.CString("")
+	defer C.free(unsafe.Pointer(e))
+
+	bs := C.pbs_statnode(C.int(handle), i, nil, e)
+	if bs == nil {
+		return nil, statError()
+	}
+	defer C.pbs_statfree(bs)
+
+	return batchStatus(bs), nil
+}
+
+// statJobRaw returns the attribs of all jobs, or all their attributes when
+// attribs is empty.
+func statJobRaw(handle int, attribs []string) ([]utils.BatchStatus, error) {
+	i := C.CString("")
+	defer C.free(unsafe.Pointer(i))
+
+	e := C.CString("")
+	defer C.free(unsafe.Pointer(e))
+
+	a := newAttrl(attribs)
+	defer freeAttrl(a)
+
+	bs := C.pbs_statjob(C.int(handle), i, a, e)
+	if bs == nil {
+		return nil, statError()
+	}
+	defer C.pbs_statfree(bs)
+
+	return batchStatus(bs), nil
+}
+
+// newAttrl returns an attrl list of the attribute names, or nil when there
+// are none. The list is in C memory, which cgo lets PBS calls take pointers
+// to, unlike the Go memory of go_pbspro's lists. It has to be released with
+// freeAttrl.
+func newAttrl(names []string) *C.struct_attrl {
+	var first *C.struct_attrl
+	next := &first
+	for _, name := range names {
+		a := (*C.struct_attrl)(C.calloc(1, C.sizeof_struct_attrl))
+		a.name = C.CString(name)
+		a.resource = C.CString("")
+		a.value = C.CString("")
+		*next = a
+		next = &a.next
+	}
+	return first
+}
+
+func freeAttrl(a *C.struct_attrl) {
+	for a != nil {
+		next := a.next
+		C.free(unsafe.Pointer(a.name))
+		C.free(unsafe.Pointer(a.resource))
+		C.free(unsafe.Pointer(a.value))
+		C.free(unsafe.Pointer(a))
+		a = next
+	}
+}
+
+// attrlNames returns the attribute names of an attrl list.
+func attrlNames(a *C.struct_attrl) []string {
+	var names []string
+	for ; a != nil; a = a.next {
+		names = append(names, C.GoString(a.name))
+	}
+	return names
+}
+
+// pbsErrno returns the pbs_errno of the calling thread.
+func pbsErrno() int {
+	return int(C.pbs_errno)
+}
+
+func lastPBSError() error {
+	return errors.New(utils.Pbs_strerror(int(C.pbs_errno)))
+}
+
+// statError returns the error of a pbs_stat* call that returned no status.
+// Without pbs_errno set, there is nothing to report, e.g. a server without
+// queues or nodes.
+func statError() error {
+	if pbsErrno() == 0 {
+		return nil
+	}
+	return lastPBSError()
+}
+
+func batchStatus(bs *C.struct_batch_status) []utils.BatchStatus {
+	var batch []utils.BatchStatus
+	for ; bs != nil; bs = bs.next {
+		attribs := []utils.Attrib{}
+		for a := bs.attribs; a != nil; a = a.next {
+			attribs = append(attribs, utils.Attrib{
+				Name:     C.GoString(a.name),
+				Resource: C.GoString(a.resource),
+				Value:    C.GoString(a.value),
+			})
+		}
+		batch = append(batch, utils.BatchStatus{
+			Name:       C.GoString(bs.name),
+			Text:       C.GoString(bs.text),
+			Attributes: attribs,
+		})
+	}
+	return batch
+}
@@ -0,0 +1,26 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewAttrl(t *testing.T) {
+	a := newAttrl(jobRawAttributes)
+	defer freeAttrl(a)
+	if got := attrlNames(a); !reflect.DeepEqual(got, jobRawAttributes) {
+		t.Errorf("got %v, want %v", got, jobRawAttributes)
+	}
+	if a := newAttrl(nil); a != nil {
+		t.Errorf("got %v for no attributes, want nil", attrlNames(a))
+	}
+}
+
+func TestStatJobRaw(t *testing.T) {
+	// The attrl list is passed to PBS, which panics under the cgo pointer
+	// checks if it holds Go pointers.
+	pbsCall(func() error {
+		_, err := statJobRaw(-1, jobRawAttributes)
+		return err
+	})
+}
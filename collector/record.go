@@ -0,0 +1,373 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/go_pbspro/utils"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	recordDir = kingpin.Flag("pbs.record-dir", "Directory to write every PBS server, queue, node and job snapshot to as JSON.").String()
+	replayDir = kingpin.Flag("pbs.replay-dir", "Directory of snapshots written with --pbs.record-dir to serve instead of querying PBS.").String()
+)
+
+// Calls of a pbsSource as named in snapshots.
+const (
+	callServerState      = "server_state"
+	callQueueState       = "queue_state"
+	callNodeState        = "node_state"
+	callJobsState        = "jobs_state"
+	callServerAttributes = "server_attributes"
+	callQueueAttributes  = "queue_attributes"
+	callNodeAttributes   = "node_attributes"
+	callJobAttributes    = "job_attributes"
+)
+
+// snapshot is what a pbsSource returned between connecting and closing.
+type snapshot struct {
+	Server string    `json:"server"`
+	Time   time.Time `json:"time"`
+	// Calls are the calls made, in order. The fields below are only
+	// meaningful for those.
+	Calls            []string                 `json:"calls"`
+	Servers          []qstat.QstatServerInfo  `json:"servers,omitempty"`
+	Queues           []qstat.QstatQueueInfo   `json:"queues,omitempty"`
+	Nodes            []qstat.QstatNodeInfo    `json:"nodes,omitempty"`
+	Jobs             []qstat.QstatJobsInfo    `json:"jobs,omitempty"`
+	ServerAttributes []utils.BatchStatus      `json:"server_attributes,omitempty"`
+	QueueAttributes  []utils.BatchStatus      `json:"queue_attributes,omitempty"`
+	NodeAttributes   []utils.BatchStatus      `json:"node_attributes,omitempty"`
+	JobAttributes    []utils.BatchStatus      `json:"job_attributes,omitempty"`
+	Errors           map[string]snapshotError `json:"errors,omitempty"`
+}
+
+// snapshotError is the error of a call.
+type snapshotError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (s *snapshot) record(call string, err error) {
+	s.Calls = append(s.Calls, call)
+	if err == nil {
+		return
+	}
+	if s.Errors == nil {
+		s.Errors = make(map[string]snapshotError)
+	}
+	e := snapshotError{Message: err.Error()}
+	if pe, ok := err.(*pbsError); ok {
+		e.Code = pe.code
+	}
+	s.Errors[call] = e
+}
+
+func (s *snapshot) err(call string) error {
+	e, ok := s.Errors[call]
+	if !ok {
+		return nil
+	}
+	return &pbsError{code: e.Code, err: errors.New(e.Message)}
+}
+
+// recordingSource writes a snapshot of the calls of src to dir on Close.
+type recordingSource struct {
+	src  pbsSource
+	dir  string
+	snap snapshot
+}
+
+func newRecordingSource(server PBSServer, src pbsSource, dir string) *recordingSource {
+	return &recordingSource{src: src, dir: dir, snap: snapshot{Server: server.Name, Time: time.Now()}}
+}
+
+func (s *recordingSource) ServerState() ([]qstat.QstatServerInfo, error) {
+	v, err := s.src.ServerState()
+	s.snap.Servers = v
+	s.snap.record(callServerState, err)
+	return v, err
+}
+
+func (s *recordingSource) QueueState() ([]qstat.QstatQueueInfo, error) {
+	v, err := s.src.QueueState()
+	s.snap.Queues = v
+	s.snap.record(callQueueState, err)
+	return v, err
+}
+
+func (s *recordingSource) NodeState() ([]qstat.QstatNodeInfo, error) {
+	v, err := s.src.NodeState()
+	s.snap.Nodes = v
+	s.snap.record(callNodeState, err)
+	return v, err
+}
+
+func (s *recordingSource) JobsState() ([]qstat.QstatJobsInfo, error) {
+	v, err := s.src.JobsState()
+	s.snap.Jobs = v
+	s.snap.record(callJobsState, err)
+	return v, err
+}
+
+func (s *recordingSource) ServerAttributes() ([]utils.BatchStatus, error) {
+	v, err := s.src.ServerAttributes()
+	s.snap.ServerAttributes = v
+	s.snap.record(callServerAttributes, err)
+	return v, err
+}
+
+func (s *recordingSource) QueueAttributes() ([]utils.BatchStatus, error) {
+	v, err := s.src.QueueAttributes()
+	s.snap.QueueAttributes = v
+	s.snap.record(callQueueAttributes, err)
+	return v, err
+}
+
+func (s *recordingSource) NodeAttributes() ([]utils.BatchStatus, error) {
+	v, err := s.src.NodeAttributes()
+	s.snap.NodeAttributes = v
+	s.snap.record(callNodeAttributes, err)
+	return v, err
+}
+
+func (s *recordingSource) JobAttributes() ([]utils.BatchStatus, error) {
+	v, err := s.src.JobAttributes()
+	s.snap.JobAttributes = v
+	s.snap.record(callJobAttributes, err)
+	return v, err
+}
+
+// Close closes src and writes the snapshot. A snapshot without calls is not
+// written.
+func (s *recordingSource) Close() error {
+	err := s.src.Close()
+	if len(s.snap.Calls) == 0 {
+		return err
+	}
+	if werr := writeSnapshot(s.dir, &s.snap); werr != nil && err == nil {
+		err = werr
+	}
+	return err
+}
+
+// writeSnapshot writes snap to dir. The file is renamed into place, so a
+// replay of a directory that is still being recorded never reads partial
+// snapshots.
+func writeSnapshot(dir string, snap *snapshot) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("record snapshot: %s", err)
+	}
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("record snapshot: %s", err)
+	}
+	// The random part of the temporary name keeps snapshots taken at the
+	// same time apart.
+	prefix := fmt.Sprintf(".%s-%s-", url.PathEscape(snap.Server), snap.Time.UTC().Format("20060102T150405.000000000Z"))
+	tmp, err := ioutil.TempFile(dir, prefix+"*.tmp")
+	if err != nil {
+		return fmt.Errorf("record snapshot: %s", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("record snapshot: %s", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("record snapshot: %s", err)
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(tmp.Name()), "."), ".tmp") + ".json"
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("record snapshot: %s", err)
+	}
+	return nil
+}
+
+// replay serves the snapshots recorded in a directory. Every call returns
+// the next recorded result of that call for the server, in the order the
+// snapshots were taken, and starts over after the last one. Replaying per
+// call rather than per snapshot keeps the sequence intact when several
+// collectors query a server concurrently.
+type replay struct {
+	dir string
+
+	mtx     sync.Mutex
+	servers map[string]*replayServer
+}
+
+// replayServer holds the recorded results of a server by call, and the
+// index of the next one to serve.
+type replayServer struct {
+	results map[string][]*snapshot
+	next    map[string]int
+}
+
+func newReplay(dir string) *replay {
+	return &replay{dir: dir, servers: make(map[string]*replayServer)}
+}
+
+var (
+	replaysMtx sync.Mutex
+	replays    = make(map[string]*replay)
+)
+
+// replayOf returns the replay of dir, which is shared by all sources so
+// that they advance through the same sequence.
+func replayOf(dir string) *replay {
+	replaysMtx.Lock()
+	defer replaysMtx.Unlock()
+	r, ok := replays[dir]
+	if !ok {
+		r = newReplay(dir)
+		replays[dir] = r
+	}
+	return r
+}
+
+// open returns a source serving the snapshots of the server. The directory
+// is read on the first open of every server.
+func (r *replay) open(server PBSServer) (pbsSource, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, ok := r.servers[server.Name]; !ok {
+		rs, err := loadReplay(r.dir, server.Name)
+		if err != nil {
+			return nil, err
+		}
+		r.servers[server.Name] = rs
+	}
+	return &replaySource{replay: r, server: server.Name}, nil
+}
+
+func loadReplay(dir, server string) (*replayServer, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("replay: %s", err)
+	}
+	var snaps []*snapshot
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("replay: %s", err)
+		}
+		snap := new(snapshot)
+		if err := json.Unmarshal(data, snap); err != nil {
+			return nil, fmt.Errorf("replay %s: %s", file, err)
+		}
+		if snap.Server == server {
+			snaps = append(snaps, snap)
+		}
+	}
+	if len(snaps) == 0 {
+		return nil, fmt.Errorf("replay: no snapshots of PBS server %s in %s", server, dir)
+	}
+	sort.SliceStable(snaps, func(i, j int) bool { return snaps[i].Time.Before(snaps[j].Time) })
+
+	rs := &replayServer{results: make(map[string][]*snapshot), next: make(map[string]int)}
+	for _, snap := range snaps {
+		for _, call := range snap.Calls {
+			rs.results[call] = append(rs.results[call], snap)
+		}
+	}
+	return rs, nil
+}
+
+// replaySource is a pbsSource of replayed snapshots.
+type replaySource struct {
+	replay *replay
+	server string
+}
+
+// next returns the snapshot holding the next result of call.
+func (s *replaySource) next(call string) (*snapshot, error) {
+	s.replay.mtx.Lock()
+	defer s.replay.mtx.Unlock()
+	rs := s.replay.servers[s.server]
+	results := rs.results[call]
+	if len(results) == 0 {
+		return nil, fmt.Errorf("replay: no %s recorded for PBS server %s", strings.Replace(call, "_", " ", -1), s.server)
+	}
+	i := rs.next[call]
+	rs.next[call] = (i + 1) % len(results)
+	return results[i], nil
+}
+
+func (s *replaySource) ServerState() ([]qstat.QstatServerInfo, error) {
+	snap, err := s.next(callServerState)
+	if err != nil {
+		return nil, err
+	}
+	return snap.Servers, snap.err(callServerState)
+}
+
+func (s *replaySource) QueueState() ([]qstat.QstatQueueInfo, error) {
+	snap, err := s.next(callQueueState)
+	if err != nil {
+		return nil, err
+	}
+	return snap.Queues, snap.err(callQueueState)
+}
+
+func (s *replaySource) NodeState() ([]qstat.QstatNodeInfo, error) {
+	snap, err := s.next(callNodeState)
+	if err != nil {
+		return nil, err
+	}
+	return snap.Nodes, snap.err(callNodeState)
+}
+
+func (s *replaySource) JobsState() ([]qstat.QstatJobsInfo, error) {
+	snap, err := s.next(callJobsState)
+	if err != nil {
+		return nil, err
+	}
+	return snap.Jobs, snap.err(callJobsState)
+}
+
+func (s *replaySource) ServerAttributes() ([]utils.BatchStatus, error) {
+	snap, err := s.next(callServerAttributes)
+	if err != nil {
+		return nil, err
+	}
+	return snap.ServerAttributes, snap.err(callServerAttributes)
+}
+
+func (s *replaySource) QueueAttributes() ([]utils.BatchStatus, error) {
+	snap, err := s.next(callQueueAttributes)
+	if err != nil {
+		return nil, err
+	}
+	return snap.QueueAttributes, snap.err(callQueueAttributes)
+}
+
+func (s *replaySource) NodeAttributes() ([]utils.BatchStatus, error) {
+	snap, err := s.next(callNodeAttributes)
+	if err != nil {
+		return nil, err
+	}
+	return snap.NodeAttributes, snap.err(callNodeAttributes)
+}
+
+func (s *replaySource) JobAttributes() ([]utils.BatchStatus, error) {
+	snap, err := s.next(callJobAttributes)
+	if err != nil {
+		return nil, err
+	}
+	return snap.JobAttributes, snap.err(callJobAttributes)
+}
+
+func (s *replaySource) Close() error { return nil }
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pbspro_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Record a healthy and a degraded scrape.
+	var want [][]byte
+	for _, name := range []string{"small", "degraded"} {
+		f := loadFixture(t, name)
+		want = append(want, scrape(t, func(server PBSServer) (pbsSource, error) {
+			return newRecordingSource(server, f, dir), nil
+		}))
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each scrape opens one source, shared by its collectors.
+	if want := 2; len(files) != want {
+		t.Fatalf("got %d snapshots, want %d", len(files), want)
+	}
+
+	// The replay serves the scrapes in order and then starts over.
+	r := newReplay(dir)
+	for i := 0; i < 3; i++ {
+		got := scrape(t, r.open)
+		if !bytes.Equal(got, want[i%2]) {
+			t.Errorf("replayed scrape %d differs from the recorded one:\n%s", i, got)
+		}
+	}
+
+	if _, err := newReplay(dir).open(PBSServer{Name: "pbs2"}); err == nil {
+		t.Error("expected an error for a server without snapshots")
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pbspro_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := PBSServer{Name: "pbs1"}
+	src := newRecordingSource(server, &fakeSource{err: &pbsError{code: 15062, err: errors.New("Unknown node")}}, dir)
+	src.NodeState()
+	if err := src.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := newReplay(dir).open(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = replayed.NodeState()
+	if e, ok := err.(*pbsError); !ok || e.code != 15062 || e.Error() != "Unknown node" {
+		t.Errorf("got error %#v, want pbs_errno 15062", err)
+	}
+	if _, err := replayed.JobsState(); err == nil {
+		t.Error("expected an error for a call that was not recorded")
+	}
+}
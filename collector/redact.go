@@ -0,0 +1,314 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Redaction actions applied to a job label.
+const (
+	RedactKeep = "keep"
+	RedactDrop = "drop"
+	RedactHash = "hash"
+	RedactMask = "mask"
+)
+
+// defaultMaskReplacement replaces regex matches of a mask rule without an
+// explicit replacement.
+const defaultMaskReplacement = "<redacted>"
+
+var (
+	redactFlags    = kingpin.Flag("collector.qstat.redact", "Redaction rule for a job label as <label>=keep|drop|hash or <label>=mask:<regex>. Repeat for several labels.").Strings()
+	labelMaxLength = kingpin.Flag("collector.qstat.label-max-length", "Truncate job label values to this many characters, 0 for no limit.").Default("0").Int()
+)
+
+// RedactionRule says what to do with the value of a job label before it is
+// exposed.
+type RedactionRule struct {
+	// Label is the job label the rule applies to, e.g. VariableList.
+	Label string
+	// Action is one of keep, drop, hash and mask. Dropped labels are left empty
+	// in the job metrics, hashed values are replaced by a short SHA-256
+	// prefix and masked values have every match of Regex replaced.
+	Action      string
+	Regex       string
+	Replacement string
+}
+
+// submitVariablesRegex matches the -v option of qsub with its variable list,
+// which may hold quoted values, e.g. -v "A=a b", and continue after a comma
+// and spaces, e.g. -v A=1, B=2. An unterminated quote runs to the end.
+const submitVariablesRegex = `((?:^|\s)-v\s*)` + submitVariableRegex + `(?:,[\s,]*` + submitVariableRegex + `)*`
+
+// submitVariableRegex matches a variable of a -v list.
+const submitVariableRegex = `(?:[^\s,"']|"[^"]*"?|'[^']*'?)+`
+
+// defaultRedactionRules keep secrets from the job environment out of the
+// exposition. The masks of JobOwner, VariableListHome, VariableListLang and
+// VariableListWrokdir keep the label values of earlier releases.
+var defaultRedactionRules = []RedactionRule{
+	{Label: "VariableList", Action: RedactDrop},
+	{Label: "SubmitArguments", Action: RedactMask, Regex: submitVariablesRegex, Replacement: "${1}" + defaultMaskReplacement},
+	{Label: "JobOwner", Action: RedactMask, Regex: `@`, Replacement: "_"},
+	{Label: "VariableListHome", Action: RedactMask, Regex: `/`, Replacement: "_"},
+	{Label: "VariableListLang", Action: RedactMask, Regex: `[.-]`, Replacement: "_"},
+	{Label: "VariableListWrokdir", Action: RedactMask, Regex: `/`, Replacement: "_"},
+}
+
+// jobLabels are the labels of the job metrics, in the order of
+// jobLabelValues.
+var jobLabels = []string{
+	"JobName",
+	"JobOwner",
+	"JobState",
+	"Queue",
+	"Server",
+	"CheckPoint",
+	"ErrorPath",
+	"ExecHost",
+	"ExecVnode",
+	"HoldType",
+	"JoinPath",
+	"KeepFiles",
+	"MailPoints",
+	"OutputPath",
+	"ResourceListPlace",
+	"ResourceListSelect",
+	"ResourceListSoftware",
+	"JobDir",
+	"VariableList",
+	"VariableListHome",
+	"VariableListLang",
+	"VariableListLogname",
+	"VariableListPath",
+	"VariableListMail",
+	"VariableListShell",
+	"VariableListWrokdir",
+	"VariableListSystem",
+	"VariableListQueue",
+	"VariableListHost",
+	"Comment",
+	"SubmitArguments",
+	"Project",
+}
+
+// jobLabelFields returns pointers to the fields of a job holding the values
+// of jobLabels.
+func jobLabelFields(ss *qstat.QstatJobsInfo) []*string {
+	return []*string{
+		&ss.JobName,
+		&ss.JobOwner,
+		&ss.JobState,
+		&ss.Queue,
+		&ss.Server,
+		&ss.CheckPoint,
+		&ss.ErrorPath,
+		&ss.ExecHost,
+		&ss.ExecVnode,
+		&ss.HoldType,
+		&ss.JoinPath,
+		&ss.KeepFiles,
+		&ss.MailPoints,
+		&ss.OutputPath,
+		&ss.ResourceListPlace,
+		&ss.ResourceListSelect,
+		&ss.ResourceListSoftware,
+		&ss.JobDir,
+		&ss.VariableList,
+		&ss.VariableListHome,
+		&ss.VariableListLang,
+		&ss.VariableListLogname,
+		&ss.VariableListPath,
+		&ss.VariableListMail,
+		&ss.VariableListShell,
+		&ss.VariableListWorkdir,
+		&ss.VariableListSystem,
+		&ss.VariableListQueue,
+		&ss.VariableListHost,
+		&ss.Comment,
+		&ss.SubmitArguments,
+		&ss.Project,
+	}
+}
+
+// jobLabelValues returns the raw values of jobLabels for a job.
+func jobLabelValues(ss qstat.QstatJobsInfo) []string {
+	var values []string
+	for _, f := range jobLabelFields(&ss) {
+		values = append(values, *f)
+	}
+	return values
+}
+
+// IsJobLabel reports whether name is a label of the job metrics that
+// redaction rules can apply to.
+func IsJobLabel(name string) bool {
+	for _, l := range jobLabels {
+		if l == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Redaction is the redaction policy of the job labels.
+type Redaction struct {
+	// Rules are applied on top of the default rules, which drop
+	// VariableList and mask -v values in SubmitArguments. A later rule for
+	// a label replaces an earlier one.
+	Rules []RedactionRule
+	// LabelMaxLength truncates label values to this many characters. Zero
+	// means no limit.
+	LabelMaxLength int
+}
+
+// FlagRedaction returns the policy given with --collector.qstat.redact and
+// --collector.qstat.label-max-length.
+func FlagRedaction() (Redaction, error) {
+	var rules []RedactionRule
+	for _, f := range *redactFlags {
+		i := strings.Index(f, "=")
+		if i < 0 {
+			return Redaction{}, fmt.Errorf("invalid redaction rule %q, expected <label>=<action>", f)
+		}
+		rule := RedactionRule{Label: f[:i], Action: f[i+1:]}
+		if strings.HasPrefix(rule.Action, RedactMask+":") {
+			rule.Action, rule.Regex = RedactMask, strings.TrimPrefix(rule.Action, RedactMask+":")
+		}
+		rules = append(rules, rule)
+	}
+	return Redaction{Rules: rules, LabelMaxLength: *labelMaxLength}, nil
+}
+
+// redactor applies the redaction rules to job labels.
+type redactor struct {
+	rules     map[string]compiledRule
+	maxLength int
+}
+
+type compiledRule struct {
+	action      string
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// newRedactor compiles the policy on top of the default rules.
+func newRedactor(policy Redaction) (*redactor, error) {
+	if policy.LabelMaxLength < 0 {
+		return nil, fmt.Errorf("invalid label max length %d", policy.LabelMaxLength)
+	}
+	r := &redactor{rules: make(map[string]compiledRule), maxLength: policy.LabelMaxLength}
+	for _, rule := range append(append([]RedactionRule{}, defaultRedactionRules...), policy.Rules...) {
+		if !IsJobLabel(rule.Label) {
+			return nil, fmt.Errorf("redaction rule: unknown job label %q", rule.Label)
+		}
+		c := compiledRule{action: rule.Action}
+		switch rule.Action {
+		case RedactKeep, RedactDrop, RedactHash:
+			if rule.Regex != "" {
+				return nil, fmt.Errorf("redaction rule for %s: regex is only valid with %s", rule.Label, RedactMask)
+			}
+		case RedactMask:
+			re, err := regexp.Compile(rule.Regex)
+			if rule.Regex == "" || err != nil {
+				return nil, fmt.Errorf("redaction rule for %s: invalid regex %q: %v", rule.Label, rule.Regex, err)
+			}
+			c.regex = re
+			c.replacement = rule.Replacement
+			if c.replacement == "" {
+				c.replacement = defaultMaskReplacement
+			}
+		default:
+			return nil, fmt.Errorf("redaction rule for %s: unknown action %q", rule.Label, rule.Action)
+		}
+		r.rules[rule.Label] = c
+	}
+	return r, nil
+}
+
+// values redacts the values returned by jobLabelValues. Dropped labels are
+// left empty, so the job metrics always have the same label names.
+func (r *redactor) values(raw []string) []string {
+	var values []string
+	for i, name := range jobLabels {
+		values = append(values, r.value(name, raw[i]))
+	}
+	return values
+}
+
+// value redacts the value of a job label.
+func (r *redactor) value(label, v string) string {
+	rule := r.rules[label]
+	switch rule.action {
+	case RedactDrop:
+		v = ""
+	case RedactHash:
+		if v != "" {
+			sum := sha256.Sum256([]byte(v))
+			v = hex.EncodeToString(sum[:8])
+		}
+	case RedactMask:
+		v = rule.regex.ReplaceAllString(v, rule.replacement)
+	}
+	return r.sanitize(v)
+}
+
+// job returns a copy of the job with its label fields redacted.
+func (r *redactor) job(ss qstat.QstatJobsInfo) qstat.QstatJobsInfo {
+	values := r.values(jobLabelValues(ss))
+	for i, f := range jobLabelFields(&ss) {
+		*f = values[i]
+	}
+	return ss
+}
+
+// hides reports whether the rule of a job label drops or hashes its value.
+func (r *redactor) hides(label string) bool {
+	action := r.rules[label].action
+	return action == RedactDrop || action == RedactHash
+}
+
+// sanitize makes v a valid label value: invalid UTF-8 is replaced and the
+// value is truncated to maxLength characters.
+func (r *redactor) sanitize(v string) string {
+	if !utf8.ValidString(v) {
+		v = strings.ToValidUTF8(v, "�")
+	}
+	if r.maxLength > 0 && utf8.RuneCountInString(v) > r.maxLength {
+		v = string([]rune(v)[:r.maxLength])
+	}
+	return v
+}
+
+var (
+	redactorMtx sync.RWMutex
+	// currentRedactor is used by the job metrics. It applies the default
+	// rules until SetRedaction is called.
+	currentRedactor, _ = newRedactor(Redaction{})
+)
+
+// SetRedaction replaces the redaction policy of the job labels.
+func SetRedaction(policy Redaction) error {
+	r, err := newRedactor(policy)
+	if err != nil {
+		return err
+	}
+	redactorMtx.Lock()
+	defer redactorMtx.Unlock()
+	currentRedactor = r
+	return nil
+}
+
+func getRedactor() *redactor {
+	redactorMtx.RLock()
+	defer redactorMtx.RUnlock()
+	return currentRedactor
+}
@@ -0,0 +1,226 @@
+package collector
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+)
+
+const secret = "s3cr3t-t0k3n"
+
+var secretJob = qstat.QstatJobsInfo{
+	JobName:             "train",
+	JobOwner:            "alice@login1",
+	Queue:               "workq",
+	VariableList:        "PBS_O_HOME=/home/alice,AWS_SECRET_ACCESS_KEY=" + secret,
+	VariableListHome:    "/home/alice",
+	VariableListLang:    "en_US.UTF-8",
+	VariableListWorkdir: "/scratch/alice",
+	SubmitArguments:     "-l select=1:ncpus=4 -v API_TOKEN=" + secret + " -- train.sh",
+	OutputPath:          "login1:/home/alice/train.o1",
+}
+
+// metricsCollector exposes fixed qstatMetrics the way the qstat collector
+// does.
+type metricsCollector []qstatMetric
+
+func (m metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	qstatMetricDefs.describe(ch)
+}
+
+func (m metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	qstatMetricDefs.send(ch, m)
+}
+
+// exposition renders the job metrics in the text format.
+func exposition(t *testing.T, jobs []qstat.QstatJobsInfo, r *redactor) string {
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(metricsCollector(jobMetrics(jobs, r))); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+func mustRedactor(t *testing.T, policy Redaction) *redactor {
+	r, err := newRedactor(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestDefaultRedactionHidesSecrets(t *testing.T) {
+	out := exposition(t, []qstat.QstatJobsInfo{secretJob}, mustRedactor(t, Redaction{}))
+	if strings.Contains(out, secret) {
+		t.Fatalf("secret found in exposition:\n%s", out)
+	}
+	if strings.Contains(out, "PBS_O_HOME") {
+		t.Errorf("VariableList label not dropped:\n%s", out)
+	}
+	for _, want := range []string{
+		`JobOwner="alice_login1"`,
+		`VariableListHome="_home_alice"`,
+		`VariableListLang="en_US_UTF_8"`,
+		`VariableListWrokdir="_scratch_alice"`,
+		`SubmitArguments="-l select=1:ncpus=4 -v <redacted> -- train.sh"`,
+		`OutputPath="login1:/home/alice/train.o1"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("exposition lacks %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestDefaultSubmitArgumentsMask(t *testing.T) {
+	r := mustRedactor(t, Redaction{})
+	for _, c := range []struct{ args, want string }{
+		{"-v API_TOKEN=secret -- train.sh", "-v <redacted> -- train.sh"},
+		{"-vAPI_TOKEN=secret train.sh", "-v<redacted> train.sh"},
+		{`-v "SECRET=a b" train.sh`, "-v <redacted> train.sh"},
+		{`-v 'SECRET=a b' train.sh`, "-v <redacted> train.sh"},
+		{"-v A=1, B=2 train.sh", "-v <redacted> train.sh"},
+		{`-v A=1,B="x y",C=3 train.sh`, "-v <redacted> train.sh"},
+		{`-l select=1 -v "A=1, B=2" -v C=3 train.sh`, "-l select=1 -v <redacted> -v <redacted> train.sh"},
+		{`-v "SECRET=a b`, "-v <redacted>"},
+		{"-N dev-v2 train.sh", "-N dev-v2 train.sh"},
+	} {
+		if got := r.job(qstat.QstatJobsInfo{SubmitArguments: c.args}).SubmitArguments; got != c.want {
+			t.Errorf("%s: got %q, want %q", c.args, got, c.want)
+		}
+	}
+}
+
+func TestRedactionRulesHideSecrets(t *testing.T) {
+	for _, rules := range [][]RedactionRule{
+		{{Label: "SubmitArguments", Action: RedactDrop}},
+		{{Label: "SubmitArguments", Action: RedactHash}},
+		{{Label: "SubmitArguments", Action: RedactMask, Regex: `API_TOKEN=\S+`, Replacement: "API_TOKEN=xxx"}},
+		// A later keep is overridden again by a later drop.
+		{{Label: "VariableList", Action: RedactKeep}, {Label: "VariableList", Action: RedactDrop}},
+	} {
+		out := exposition(t, []qstat.QstatJobsInfo{secretJob}, mustRedactor(t, Redaction{Rules: rules}))
+		if strings.Contains(out, secret) {
+			t.Errorf("%+v: secret found in exposition:\n%s", rules, out)
+		}
+	}
+}
+
+func TestRedactorValues(t *testing.T) {
+	r := mustRedactor(t, Redaction{
+		Rules: []RedactionRule{
+			{Label: "JobOwner", Action: RedactKeep},
+			{Label: "OutputPath", Action: RedactHash},
+			{Label: "Comment", Action: RedactMask, Regex: `\d+`},
+			{Label: "Project", Action: RedactDrop},
+		},
+		LabelMaxLength: 5,
+	})
+
+	raw := make([]string, len(jobLabels))
+	want := make(map[string]string)
+	set := func(label, value, redacted string) {
+		for i, l := range jobLabels {
+			if l == label {
+				raw[i] = value
+				want[label] = redacted
+				return
+			}
+		}
+		t.Fatalf("unknown job label %s", label)
+	}
+	set("JobOwner", "bob@h", "bob@h")
+	set("OutputPath", "h:/out", "12dca")
+	set("Comment", "42", "<reda")
+	set("JobName", "a\xffb", "a\ufffdb")
+	set("Queue", "verylongqueue", "veryl")
+
+	values := r.values(raw)
+	if len(values) != len(jobLabels) {
+		t.Fatalf("got %d values, want %d", len(values), len(jobLabels))
+	}
+	for i, l := range jobLabels {
+		if (l == "Project" || l == "VariableList") && values[i] != "" {
+			t.Errorf("dropped label %s exposed as %q", l, values[i])
+		}
+		if w, ok := want[l]; ok && values[i] != w {
+			t.Errorf("%s: got %q, want %q", l, values[i], w)
+		}
+	}
+}
+
+func TestNewRedactorErrors(t *testing.T) {
+	for _, policy := range []Redaction{
+		{Rules: []RedactionRule{{Label: "Secret", Action: RedactDrop}}},
+		{Rules: []RedactionRule{{Label: "JobName", Action: "encrypt"}}},
+		{Rules: []RedactionRule{{Label: "JobName", Action: RedactMask}}},
+		{Rules: []RedactionRule{{Label: "JobName", Action: RedactMask, Regex: "("}}},
+		{Rules: []RedactionRule{{Label: "JobName", Action: RedactDrop, Regex: "x"}}},
+		{LabelMaxLength: -1},
+	} {
+		if _, err := newRedactor(policy); err == nil {
+			t.Errorf("%+v: expected error", policy)
+		}
+	}
+}
+
+func TestFlagRedaction(t *testing.T) {
+	defer func(f []string) { *redactFlags = f }(*redactFlags)
+
+	*redactFlags = []string{"VariableListPath=hash", "Comment=mask:a=b"}
+	r, err := FlagRedaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RedactionRule{
+		{Label: "VariableListPath", Action: RedactHash},
+		{Label: "Comment", Action: RedactMask, Regex: "a=b"},
+	}
+	if len(r.Rules) != len(want) {
+		t.Fatalf("got %+v, want %+v", r.Rules, want)
+	}
+	for i := range want {
+		if r.Rules[i] != want[i] {
+			t.Errorf("rule %d: got %+v, want %+v", i, r.Rules[i], want[i])
+		}
+	}
+
+	*redactFlags = []string{"VariableList"}
+	if _, err := FlagRedaction(); err == nil {
+		t.Error("expected error for rule without action")
+	}
+}
+
+func TestSettingsRedaction(t *testing.T) {
+	s, err := NewSettings(map[string]bool{"qstat": true}, Redaction{
+		Rules: []RedactionRule{{Label: "JobOwner", Action: RedactHash}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.NewProbeCollector(PBSServer{Name: "pbs1", Address: "pbs1"}, log.Base())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := c.Collectors["qstat"].(*qstatCollector).redactor; r != s.redactor {
+		t.Error("qstat collector doesn't redact with the settings")
+	}
+	// The current policy stays unchanged.
+	if getRedactor().hides("JobOwner") {
+		t.Error("settings applied to the current redaction policy")
+	}
+}
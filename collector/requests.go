@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics about the PBS API calls of the exporter. They are registered with
+// RegisterRequestMetrics.
+var (
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "pbspro_exporter",
+			Subsystem: "pbs",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of PBS API calls.",
+			Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"server", "call"},
+	)
+	requestErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "pbspro_exporter",
+			Subsystem: "pbs",
+			Name:      "request_errors_total",
+			Help:      "Failed PBS API calls by pbs_errno.",
+		},
+		[]string{"server", "call", "code"},
+	)
+	requestObjects = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "pbspro_exporter",
+			Subsystem: "pbs",
+			Name:      "request_objects",
+			Help:      "Number of objects returned by the last successful PBS API call.",
+		},
+		[]string{"server", "call"},
+	)
+)
+
+// RegisterRequestMetrics registers the metrics about PBS API calls.
+func RegisterRequestMetrics(r prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{requestDuration, requestErrors, requestObjects} {
+		if err := r.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// probeServer is the server label of the request metrics of all /probe
+// targets, which are chosen by the scraper.
+const probeServer = "probe"
+
+// requestServer returns the server label of the request metrics of server.
+func requestServer(server PBSServer) string {
+	if server.Probe {
+		return probeServer
+	}
+	return server.Name
+}
+
+// observeRequest records a PBS API call that returned n objects, or failed
+// with err.
+func observeRequest(server, call string, begin time.Time, n int, err error) {
+	requestDuration.WithLabelValues(server, call).Observe(time.Since(begin).Seconds())
+	if err != nil {
+		code := "unknown"
+		if e, ok := err.(*pbsError); ok {
+			code = strconv.Itoa(e.code)
+		}
+		requestErrors.WithLabelValues(server, call, code).Inc()
+		return
+	}
+	if n >= 0 {
+		requestObjects.WithLabelValues(server, call).Set(float64(n))
+	}
+}
+
+// instrumentedSource records the request metrics of every call of a
+// pbsSource.
+type instrumentedSource struct {
+	// server is the server label of the request metrics.
+	server string
+	src    pbsSource
+}
+
+// newInstrumentedSource opens a source with open and instruments it.
+func newInstrumentedSource(server PBSServer, open func(PBSServer) (pbsSource, error)) (pbsSource, error) {
+	begin := time.Now()
+	src, err := open(server)
+	observeRequest(requestServer(server), "connect", begin, -1, err)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedSource{server: requestServer(server), src: src}, nil
+}
+
+func (s *instrumentedSource) ServerState() ([]qstat.QstatServerInfo, error) {
+	begin := time.Now()
+	v, err := s.src.ServerState()
+	observeRequest(s.server, "statserver", begin, len(v), err)
+	return v, err
+}
+
+func (s *instrumentedSource) QueueState() ([]qstat.QstatQueueInfo, error) {
+	begin := time.Now()
+	v, err := s.src.QueueState()
+	observeRequest(s.server, "statque", begin, len(v), err)
+	return v, err
+}
+
+func (s *instrumentedSource) NodeState() ([]qstat.QstatNodeInfo, error) {
+	begin := time.Now()
+	v, err := s.src.NodeState()
+	observeRequest(s.server, "statnode", begin, len(v), err)
+	return v, err
+}
+
+func (s *instrumentedSource) JobsState() ([]qstat.QstatJobsInfo, error) {
+	begin := time.Now()
+	v, err := s.src.JobsState()
+	observeRequest(s.server, "selstat", begin, len(v), err)
+	return v, err
+}
+
+func (s *instrumentedSource) ServerAttributes() ([]utils.BatchStatus, error) {
+	begin := time.Now()
+	v, err := s.src.ServerAttributes()
+	observeRequest(s.server, "statserver_raw", begin, len(v), err)
+	return v, err
+}
+
+func (s *instrumentedSource) QueueAttributes() ([]utils.BatchStatus, error) {
+	begin := time.Now()
+	v, err := s.src.QueueAttributes()
+	observeRequest(s.server, "statque_raw", begin, len(v), err)
+	return v, err
+}
+
+func (s *instrumentedSource) NodeAttributes() ([]utils.BatchStatus, error) {
+	begin := time.Now()
+	v, err := s.src.NodeAttributes()
+	observeRequest(s.server, "statnode_raw", begin, len(v), err)
+	return v, err
+}
+
+func (s *instrumentedSource) JobAttributes() ([]utils.BatchStatus, error) {
+	begin := time.Now()
+	v, err := s.src.JobAttributes()
+	observeRequest(s.server, "statjob", begin, len(v), err)
+	return v, err
+}
+
+func (s *instrumentedSource) Close() error {
+	begin := time.Now()
+	err := s.src.Close()
+	observeRequest(s.server, "disconnect", begin, -1, err)
+	return err
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeSource returns fixed state, and err from NodeState.
+type fakeSource struct {
+	servers     []qstat.QstatServerInfo
+	queues      []qstat.QstatQueueInfo
+	nodes       []qstat.QstatNodeInfo
+	jobs        []qstat.QstatJobsInfo
+	serverAttrs []utils.BatchStatus
+	queueAttrs  []utils.BatchStatus
+	nodeAttrs   []utils.BatchStatus
+	jobAttrs    []utils.BatchStatus
+	err         error
+}
+
+func (s *fakeSource) ServerState() ([]qstat.QstatServerInfo, error) { return s.servers, nil }
+func (s *fakeSource) QueueState() ([]qstat.QstatQueueInfo, error)   { return s.queues, nil }
+func (s *fakeSource) NodeState() ([]qstat.QstatNodeInfo, error)     { return s.nodes, s.err }
+func (s *fakeSource) JobsState() ([]qstat.QstatJobsInfo, error)     { return s.jobs, nil }
+func (s *fakeSource) ServerAttributes() ([]utils.BatchStatus, error) {
+	return s.serverAttrs, nil
+}
+func (s *fakeSource) QueueAttributes() ([]utils.BatchStatus, error) {
+	return s.queueAttrs, nil
+}
+func (s *fakeSource) NodeAttributes() ([]utils.BatchStatus, error) {
+	return s.nodeAttrs, nil
+}
+func (s *fakeSource) JobAttributes() ([]utils.BatchStatus, error) {
+	return s.jobAttrs, nil
+}
+func (s *fakeSource) Close() error { return nil }
+
+func TestInstrumentedSource(t *testing.T) {
+	requestDuration.Reset()
+	requestErrors.Reset()
+	requestObjects.Reset()
+
+	fake := &fakeSource{
+		jobs: make([]qstat.QstatJobsInfo, 3),
+		err:  &pbsError{code: 15020, err: errors.New("Unknown node")},
+	}
+	server := PBSServer{Name: "pbs1", Address: "pbs1"}
+	src, err := newInstrumentedSource(server, func(PBSServer) (pbsSource, error) { return fake, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.JobsState()
+	src.NodeState()
+	src.ServerAttributes()
+	src.QueueAttributes()
+	src.Close()
+
+	// Probe targets don't get a server label of their own.
+	probe, err := newInstrumentedSource(PBSServer{Name: "10.0.0.9", Address: "10.0.0.9", Probe: true}, func(PBSServer) (pbsSource, error) { return fake, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe.JobsState()
+	probe.Close()
+
+	if _, err := newInstrumentedSource(server, func(PBSServer) (pbsSource, error) {
+		return nil, errors.New("no route to host")
+	}); err == nil {
+		t.Fatal("expected connect error")
+	}
+
+	r := prometheus.NewPedanticRegistry()
+	if err := RegisterRequestMetrics(r); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP pbspro_exporter_pbs_request_errors_total Failed PBS API calls by pbs_errno.
+# TYPE pbspro_exporter_pbs_request_errors_total counter
+pbspro_exporter_pbs_request_errors_total{call="connect",code="unknown",server="pbs1"} 1
+pbspro_exporter_pbs_request_errors_total{call="statnode",code="15020",server="pbs1"} 1
+# HELP pbspro_exporter_pbs_request_objects Number of objects returned by the last successful PBS API call.
+# TYPE pbspro_exporter_pbs_request_objects gauge
+pbspro_exporter_pbs_request_objects{call="selstat",server="pbs1"} 3
+pbspro_exporter_pbs_request_objects{call="selstat",server="probe"} 3
+pbspro_exporter_pbs_request_objects{call="statque_raw",server="pbs1"} 0
+pbspro_exporter_pbs_request_objects{call="statserver_raw",server="pbs1"} 0
+`
+	if err := testutil.GatherAndCompare(r, strings.NewReader(expected),
+		"pbspro_exporter_pbs_request_errors_total", "pbspro_exporter_pbs_request_objects"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps PBS size suffixes to bytes. A "w" suffix is a word, which
+// PBS defines as 8 bytes on all supported platforms.
+var sizeUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"kb", 1 << 10},
+	{"mb", 1 << 20},
+	{"gb", 1 << 30},
+	{"tb", 1 << 40},
+	{"pb", 1 << 50},
+	{"kw", 8 << 10},
+	{"mw", 8 << 20},
+	{"gw", 8 << 30},
+	{"tw", 8 << 40},
+	{"pw", 8 << 50},
+	{"b", 1},
+	{"w", 8},
+}
+
+// parseSize parses a PBS size value such as "64gb" or "1024kb" into bytes.
+// Values without a suffix are bytes.
+func parseSize(s string) (float64, bool) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	factor := float64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v = strings.TrimSuffix(v, u.suffix)
+			factor = u.factor
+			break
+		}
+	}
+	n, ok := parseDecimal(v)
+	if !ok {
+		return 0, false
+	}
+	return n * factor, true
+}
+
+// parseDecimal parses a finite decimal number. Unlike strconv.ParseFloat it
+// rejects inf, nan and hexadecimal floats, which PBS never reports.
+func parseDecimal(s string) (float64, bool) {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return !strings.ContainsRune("0123456789.eE+-", r)
+	}) >= 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, false
+	}
+	return n, true
+}
+
+// parseDuration parses a PBS time value, either [[HH:]MM:]SS[.ms] or a plain
+// number of seconds, into seconds.
+func parseDuration(s string) (float64, bool) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) > 3 {
+		return 0, false
+	}
+	var seconds float64
+	for _, p := range parts {
+		n, ok := parseDecimal(p)
+		if !ok || n < 0 {
+			return 0, false
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds, true
+}
+
+// parseResourceValue converts the value of a PBS resource into a float.
+// Sizes are returned in bytes, times in seconds and booleans as 0 or 1.
+// String resources (arch, host, ...) are reported as not numeric.
+func parseResourceValue(s string) (float64, bool) {
+	v := strings.TrimSpace(s)
+	switch v {
+	case "":
+		return 0, false
+	case "True", "true":
+		return 1, true
+	case "False", "false":
+		return 0, true
+	}
+	if strings.Contains(v, ":") {
+		return parseDuration(v)
+	}
+	return parseSize(v)
+}
+
+// parseBool reports whether a PBS boolean attribute is set, as 0 or 1.
+func parseBool(s string) float64 {
+	if v, ok := parseResourceValue(s); ok && v != 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+package collector
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"1024", 1024, true},
+		{"64gb", 64 << 30, true},
+		{"64GB", 64 << 30, true},
+		{"1024kb", 1 << 20, true},
+		{"512mb", 512 << 20, true},
+		{"2tb", 2 << 40, true},
+		{"10w", 80, true},
+		{"1kw", 8 << 10, true},
+		{"100b", 100, true},
+		{"1.5gb", 1.5 * (1 << 30), true},
+		{"", 0, false},
+		{"gb", 0, false},
+		{"abc", 0, false},
+		{"inf", 0, false},
+		{"+Inf", 0, false},
+		{"nan", 0, false},
+		{"0x10", 0, false},
+		{"0x1p4kb", 0, false},
+		{"1e400", 0, false},
+	} {
+		got, ok := parseSize(test.in)
+		if ok != test.ok || got != test.want {
+			t.Errorf("parseSize(%q) = %v, %v, want %v, %v", test.in, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"3600", 3600, true},
+		{"01:30:00", 5400, true},
+		{"48:00:00", 172800, true},
+		{"05:30", 330, true},
+		{"00:00:01.5", 1.5, true},
+		{"1:2:3:4", 0, false},
+		{"01:-1:00", 0, false},
+		{"01::00", 0, false},
+		{"inf:00", 0, false},
+		{"nan", 0, false},
+	} {
+		got, ok := parseDuration(test.in)
+		if ok != test.ok || got != test.want {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v, %v", test.in, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestParseResourceValue(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"32", 32, true},
+		{" 16gb ", 16 << 30, true},
+		{"01:00:00", 3600, true},
+		{"True", 1, true},
+		{"false", 0, true},
+		{"linux", 0, false},
+		{"", 0, false},
+		{"Inf", 0, false},
+		{"NaN", 0, false},
+	} {
+		got, ok := parseResourceValue(test.in)
+		if ok != test.ok || got != test.want {
+			t.Errorf("parseResourceValue(%q) = %v, %v, want %v, %v", test.in, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/go_pbspro/utils"
+)
+
+// scrapeSource is the pbsSource shared by the collectors of one scrape of a
+// server. It connects on the first call and makes every call at most once,
+// so collectors reading the same objects share one PBS request. Calls are
+// serialised, as a PBS connection can't be used concurrently.
+type scrapeSource struct {
+	server PBSServer
+	begin  time.Time
+
+	mtx sync.Mutex
+	src pbsSource
+	// err is the error of connecting to the server.
+	err     error
+	results map[string]scrapeResult
+}
+
+type scrapeResult struct {
+	value interface{}
+	err   error
+}
+
+func newScrapeSource(server PBSServer) *scrapeSource {
+	return &scrapeSource{server: server, begin: time.Now(), results: make(map[string]scrapeResult)}
+}
+
+// call returns the result of the named call, making it with f unless an
+// earlier collector of the scrape did.
+func (s *scrapeSource) call(name string, f func(src pbsSource) (interface{}, error)) (interface{}, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if r, ok := s.results[name]; ok {
+		return r.value, r.err
+	}
+	if s.src == nil && s.err == nil {
+		s.src, s.err = newSource(s.server)
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	v, err := f(s.src)
+	s.results[name] = scrapeResult{value: v, err: err}
+	return v, err
+}
+
+func (s *scrapeSource) ServerState() ([]qstat.QstatServerInfo, error) {
+	v, err := s.call(callServerState, func(src pbsSource) (interface{}, error) { return src.ServerState() })
+	servers, _ := v.([]qstat.QstatServerInfo)
+	return servers, err
+}
+
+func (s *scrapeSource) QueueState() ([]qstat.QstatQueueInfo, error) {
+	v, err := s.call(callQueueState, func(src pbsSource) (interface{}, error) { return src.QueueState() })
+	queues, _ := v.([]qstat.QstatQueueInfo)
+	return queues, err
+}
+
+func (s *scrapeSource) NodeState() ([]qstat.QstatNodeInfo, error) {
+	v, err := s.call(callNodeState, func(src pbsSource) (interface{}, error) { return src.NodeState() })
+	nodes, _ := v.([]qstat.QstatNodeInfo)
+	return nodes, err
+}
+
+func (s *scrapeSource) JobsState() ([]qstat.QstatJobsInfo, error) {
+	v, err := s.call(callJobsState, func(src pbsSource) (interface{}, error) { return src.JobsState() })
+	jobs, _ := v.([]qstat.QstatJobsInfo)
+	return jobs, err
+}
+
+func (s *scrapeSource) ServerAttributes() ([]utils.BatchStatus, error) {
+	return s.attributes(callServerAttributes, pbsSource.ServerAttributes)
+}
+
+func (s *scrapeSource) QueueAttributes() ([]utils.BatchStatus, error) {
+	return s.attributes(callQueueAttributes, pbsSource.QueueAttributes)
+}
+
+func (s *scrapeSource) NodeAttributes() ([]utils.BatchStatus, error) {
+	return s.attributes(callNodeAttributes, pbsSource.NodeAttributes)
+}
+
+func (s *scrapeSource) JobAttributes() ([]utils.BatchStatus, error) {
+	return s.attributes(callJobAttributes, pbsSource.JobAttributes)
+}
+
+func (s *scrapeSource) attributes(name string, f func(pbsSource) ([]utils.BatchStatus, error)) ([]utils.BatchStatus, error) {
+	v, err := s.call(name, func(src pbsSource) (interface{}, error) { return f(src) })
+	attribs, _ := v.([]utils.BatchStatus)
+	return attribs, err
+}
+
+// Close does nothing, the source is closed with close once all collectors
+// of the scrape are done.
+func (s *scrapeSource) Close() error {
+	return nil
+}
+
+// close disconnects from the server if a collector connected.
+func (s *scrapeSource) close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.src == nil {
+		return nil
+	}
+	err := s.src.Close()
+	s.src = nil
+	return err
+}
+
+// state returns the state of the server read by the scrape, or nil unless
+// the collectors read all of it successfully.
+func (s *scrapeSource) state() *State {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, call := range []string{callServerState, callQueueState, callNodeState, callNodeAttributes, callJobsState, callJobAttributes} {
+		if r, ok := s.results[call]; !ok || r.err != nil {
+			return nil
+		}
+	}
+	state := NewState(s.server, s.begin,
+		s.results[callServerState].value.([]qstat.QstatServerInfo),
+		s.results[callQueueState].value.([]qstat.QstatQueueInfo),
+		s.results[callNodeState].value.([]qstat.QstatNodeInfo),
+		s.results[callJobsState].value.([]qstat.QstatJobsInfo),
+	)
+	state.NodeAttributes = s.results[callNodeAttributes].value.([]utils.BatchStatus)
+	state.JobAttributes = s.results[callJobAttributes].value.([]utils.BatchStatus)
+	return state
+}
@@ -0,0 +1,191 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// jobRequest is what a job requested with Resource_List.select, summed over
+// its chunks, and how it asked for the chunks to be placed.
+type jobRequest struct {
+	chunks    float64
+	resources resourceSums
+	place     placement
+}
+
+// placement is a parsed Resource_List.place. Fields the job didn't set are
+// empty.
+type placement struct {
+	// arrangement is free, pack, scatter or vscatter.
+	arrangement string
+	// sharing is excl, shared or exclhost.
+	sharing string
+	// group is the resource of group=<resource>.
+	group string
+}
+
+var (
+	placeArrangements = map[string]bool{"free": true, "pack": true, "scatter": true, "vscatter": true}
+	placeSharings     = map[string]bool{"excl": true, "shared": true, "exclhost": true}
+)
+
+// parseSelect parses a select statement such as 2:ncpus=16:mem=64gb+1:ngpus=2
+// into the number of chunks and the resources summed over the chunks. Sizes
+// are in bytes and times in seconds. String and boolean resources, e.g. host
+// or a custom bigmem=true, choose nodes rather than consume them and are left
+// out.
+func parseSelect(s string) (float64, resourceSums, error) {
+	chunks, err := splitQuoted(s, '+')
+	if err != nil {
+		return 0, nil, err
+	}
+	var (
+		total     float64
+		resources resourceSums
+	)
+	for _, chunk := range chunks {
+		fields, err := splitQuoted(chunk, ':')
+		if err != nil {
+			return 0, nil, err
+		}
+		n := float64(1)
+		if c, err := strconv.ParseUint(fields[0], 10, 32); err == nil {
+			if c == 0 {
+				return 0, nil, fmt.Errorf("zero chunks in %q", s)
+			}
+			n = float64(c)
+			fields = fields[1:]
+		}
+		total += n
+
+		seen := make(map[string]bool)
+		for _, f := range fields {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 || !validResourceName(kv[0]) || kv[1] == "" {
+				return 0, nil, fmt.Errorf("invalid resource %q in %q", f, s)
+			}
+			if seen[kv[0]] {
+				return 0, nil, fmt.Errorf("resource %s requested twice in a chunk of %q", kv[0], s)
+			}
+			seen[kv[0]] = true
+
+			v := unquote(kv[1])
+			if isBoolValue(v) {
+				continue
+			}
+			value, ok := parseResourceValue(v)
+			if !ok {
+				continue
+			}
+			if value < 0 {
+				return 0, nil, fmt.Errorf("invalid value of %s in %q", kv[0], s)
+			}
+			resources.add(kv[0], n*value)
+		}
+	}
+	for _, r := range resources {
+		if math.IsInf(r.value, 0) {
+			return 0, nil, fmt.Errorf("value of %s out of range in %q", r.name, s)
+		}
+	}
+	return total, resources, nil
+}
+
+// parsePlace parses a place statement such as scatter:excl:group=switch.
+func parsePlace(s string) (placement, error) {
+	var p placement
+	if s == "" {
+		return p, nil
+	}
+	for _, f := range strings.Split(s, ":") {
+		var field *string
+		switch {
+		case placeArrangements[f]:
+			field = &p.arrangement
+		case placeSharings[f]:
+			field = &p.sharing
+		case strings.HasPrefix(f, "group="):
+			if !validResourceName(f[len("group="):]) {
+				return placement{}, fmt.Errorf("invalid group %q in %q", f, s)
+			}
+			field = &p.group
+			f = f[len("group="):]
+		default:
+			return placement{}, fmt.Errorf("invalid placement %q in %q", f, s)
+		}
+		if *field != "" {
+			return placement{}, fmt.Errorf("conflicting placement %q in %q", f, s)
+		}
+		*field = f
+	}
+	return p, nil
+}
+
+// splitQuoted splits s around sep outside of single or double quotes, as
+// string_array values like 'a,b' may hold any character. It fails on empty
+// fields and unterminated quotes.
+func splitQuoted(s string, sep byte) ([]string, error) {
+	var (
+		fields []string
+		quote  byte
+		start  int
+	)
+	for i := 0; i <= len(s); i++ {
+		switch {
+		case i == len(s):
+			if quote != 0 {
+				return nil, fmt.Errorf("unterminated quote in %q", s)
+			}
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+			continue
+		case s[i] == '\'' || s[i] == '"':
+			quote = s[i]
+			continue
+		case s[i] != sep:
+			continue
+		}
+		if i == start {
+			return nil, fmt.Errorf("empty field in %q", s)
+		}
+		fields = append(fields, s[start:i])
+		start = i + 1
+	}
+	return fields, nil
+}
+
+// unquote removes the quotes around a resource value.
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// isBoolValue reports whether v is one of the spellings of a PBS boolean
+// other than 0 and 1.
+func isBoolValue(v string) bool {
+	switch strings.ToLower(v) {
+	case "true", "false", "t", "f", "y", "n":
+		return true
+	}
+	return false
+}
+
+// validResourceName reports whether s is a PBS resource name: a letter
+// followed by letters, digits, underscores and dashes.
+func validResourceName(s string) bool {
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c >= '0' && c <= '9' || c == '_' || c == '-'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
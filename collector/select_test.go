@@ -0,0 +1,117 @@
+package collector
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseSelect(t *testing.T) {
+	for _, test := range []struct {
+		in        string
+		chunks    float64
+		resources resourceSums
+	}{
+		{"1:ncpus=4", 1, resourceSums{{"ncpus", 4}}},
+		{"2:ncpus=16:mem=64gb:ngpus=2", 2, resourceSums{{"ncpus", 32}, {"mem", 128 << 30}, {"ngpus", 4}}},
+		{"ncpus=8+3:ncpus=1:mem=1gb", 4, resourceSums{{"ncpus", 11}, {"mem", 3 << 30}}},
+		{"4:ncpus=2:scratch=10gb:licenses=1", 4, resourceSums{{"ncpus", 8}, {"scratch", 40 << 30}, {"licenses", 4}}},
+		{"1:ncpus=2:host=cn001:bigmem=true:arch=linux", 1, resourceSums{{"ncpus", 2}}},
+		{"1:ncpus=1:software='a:b+c'", 1, resourceSums{{"ncpus", 1}}},
+		{"1:walltime_limit='01:00'", 1, resourceSums{{"walltime_limit", 60}}},
+		{"1:ncpus=2:tag=nan", 1, resourceSums{{"ncpus", 2}}},
+		{"2", 2, nil},
+	} {
+		chunks, resources, err := parseSelect(test.in)
+		if err != nil {
+			t.Errorf("%s: %s", test.in, err)
+			continue
+		}
+		if chunks != test.chunks || !reflect.DeepEqual(resources, test.resources) {
+			t.Errorf("%s: got %v %v, want %v %v", test.in, chunks, resources, test.chunks, test.resources)
+		}
+	}
+
+	for _, in := range []string{
+		"", "+", "1:ncpus=1+", "0:ncpus=1", "1:", "1:ncpus", "1:ncpus=", "1:=4",
+		"1:ncpus=1:ncpus=2", "1:ncpus=-1", "1:software='a", "1:9cpus=1",
+		"4294967295:mem=1e308",
+	} {
+		if _, _, err := parseSelect(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
+
+func TestParsePlace(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want placement
+	}{
+		{"", placement{}},
+		{"pack", placement{arrangement: "pack"}},
+		{"scatter:excl", placement{arrangement: "scatter", sharing: "excl"}},
+		{"exclhost:vscatter:group=switch", placement{arrangement: "vscatter", sharing: "exclhost", group: "switch"}},
+		{"group=rack", placement{group: "rack"}},
+	} {
+		got, err := parsePlace(test.in)
+		if err != nil {
+			t.Errorf("%s: %s", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %+v, want %+v", test.in, got, test.want)
+		}
+	}
+
+	for _, in := range []string{"packed", "pack:scatter", "excl:shared", "group=", "group=a:group=b", "pack:"} {
+		if _, err := parsePlace(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
+
+func FuzzParseSelect(f *testing.F) {
+	for _, s := range []string{
+		"1:ncpus=4", "2:ncpus=16:mem=64gb:ngpus=2+1:ncpus=1", "1:host=cn001:bigmem=true",
+		"1:software='a:b+c'", "3:walltime_limit='01:00:00'", "1:ncpus=1e308+1:ncpus=1e308",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		chunks, resources, err := parseSelect(s)
+		if err != nil {
+			return
+		}
+		if chunks < 1 || chunks != math.Trunc(chunks) {
+			t.Errorf("%q: invalid number of chunks %v", s, chunks)
+		}
+		seen := make(map[string]bool)
+		for _, r := range resources {
+			if !validResourceName(r.name) || seen[r.name] {
+				t.Errorf("%q: invalid or duplicate resource %q", s, r.name)
+			}
+			seen[r.name] = true
+			if r.value < 0 || math.IsNaN(r.value) || math.IsInf(r.value, 0) {
+				t.Errorf("%q: invalid value %v of %s", s, r.value, r.name)
+			}
+		}
+	})
+}
+
+func FuzzParsePlace(f *testing.F) {
+	for _, s := range []string{"pack", "scatter:excl", "free:shared:group=switch", "vscatter:exclhost"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		p, err := parsePlace(s)
+		if err != nil {
+			return
+		}
+		if p.arrangement != "" && !placeArrangements[p.arrangement] ||
+			p.sharing != "" && !placeSharings[p.sharing] ||
+			p.group != "" && !validResourceName(p.group) {
+			t.Errorf("%q: invalid placement %+v", s, p)
+		}
+	})
+}
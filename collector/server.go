@@ -0,0 +1,224 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+func init() {
+	registerCollector(serverCollectorSubSystem, defaultEnabled, NewServerCollector)
+}
+
+// volatileAttributes are server and queue attributes that describe the
+// current state rather than the qmgr configuration. They are left out of
+// the configuration hash.
+var volatileAttributes = map[string]bool{
+	"server_state":       true,
+	"total_jobs":         true,
+	"state_count":        true,
+	"resources_assigned": true,
+	"license_count":      true,
+	"FLicenses":          true,
+	"hasnodes":           true,
+}
+
+// serverBoolAttributes are boolean server settings exported as their own
+// metric.
+var serverBoolAttributes = map[string]bool{
+	"flatuid":           true,
+	"node_group_enable": true,
+}
+
+// serverResourceAttributes are the per-resource server attributes exported
+// with a Resource label.
+var serverResourceAttributes = map[string]bool{
+	"resources_available": true,
+	"resources_default":   true,
+	"resources_max":       true,
+	"default_chunk":       true,
+}
+
+// serverInfoLabels are the label names of the config_info metric after the
+// server name.
+var serverInfoLabels = []string{"ServerHost", "PBSVersion", "DefaultQueue", "NodeGroupKey", "Hash"}
+
+// serverMetricDefs are the metrics of the server collector. All of them are
+// labelled with ServerName first.
+var serverMetricDefs = defineMetrics(serverCollectorSubSystem,
+	metricDef{"limit", "pbspro_exporter: Server Limit. Sizes are in bytes, times in seconds.", withLabels([]string{"ServerName"}, limitLabels...)},
+	metricDef{"resources_available", "pbspro_exporter: Server resources_available. Sizes are in bytes, times in seconds.", []string{"ServerName", "Resource"}},
+	metricDef{"resources_default", "pbspro_exporter: Server resources_default. Sizes are in bytes, times in seconds.", []string{"ServerName", "Resource"}},
+	metricDef{"resources_max", "pbspro_exporter: Server resources_max. Sizes are in bytes, times in seconds.", []string{"ServerName", "Resource"}},
+	metricDef{"default_chunk", "pbspro_exporter: Server default_chunk. Sizes are in bytes, times in seconds.", []string{"ServerName", "Resource"}},
+	metricDef{"flatuid", "pbspro_exporter: Server flatuid. 1 is True", []string{"ServerName"}},
+	metricDef{"node_group_enable", "pbspro_exporter: Server node_group_enable. 1 is True", []string{"ServerName"}},
+	metricDef{"acl_enable", "pbspro_exporter: Server ACL Enable. 1 is True", []string{"ServerName", "Acl"}},
+	metricDef{"backfill_depth", "pbspro_exporter: Server Backfill Depth.", []string{"ServerName"}},
+	metricDef{"scheduler_iteration_seconds", "pbspro_exporter: Time between scheduling cycles started by the server.", []string{"ServerName"}},
+	metricDef{"config_info", "pbspro_exporter: Server configuration. Hash changes whenever the server or queue configuration changes.", withLabels([]string{"ServerName"}, serverInfoLabels...)},
+	metricDef{"config_hash", "pbspro_exporter: Hash of the server and queue configuration.", []string{"ServerName"}},
+)
+
+type serverCollector struct {
+	server PBSServer
+	logger log.Logger
+}
+
+// NewServerCollector returns a collector exporting the server's limits and
+// configuration, as set with qmgr.
+func NewServerCollector(server PBSServer, logger log.Logger) (Collector, error) {
+	return &serverCollector{server: server, logger: logger}, nil
+}
+
+func (c *serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	serverMetricDefs.describe(ch)
+}
+
+func (c *serverCollector) Update(src pbsSource, ch chan<- prometheus.Metric) error {
+	servers, err := src.ServerAttributes()
+	if err != nil {
+		return fmt.Errorf("stat server: %s", err)
+	}
+	queues, err := src.QueueAttributes()
+	if err != nil {
+		return fmt.Errorf("stat queues: %s", err)
+	}
+
+	hash := configHash(servers, queues)
+
+	for _, s := range servers {
+		metrics := serverConfigMetrics(s.Attributes, c.logger)
+		metrics = append(metrics, qstatMetric{
+			name:            "config_info",
+			value:           1,
+			metricType:      prometheus.GaugeValue,
+			extraLabel:      serverInfoLabels,
+			extraLabelValue: []string{attribute(s.Attributes, "server_host"), attribute(s.Attributes, "pbs_version"), attribute(s.Attributes, "default_queue"), attribute(s.Attributes, "node_group_key"), hex.EncodeToString(hash[:8])},
+		}, qstatMetric{
+			name:       "config_hash",
+			value:      float64(binary.BigEndian.Uint64(hash[:8]) >> 11),
+			metricType: prometheus.GaugeValue,
+		})
+
+		for i := range metrics {
+			metrics[i].extraLabel = withLabels([]string{"ServerName"}, metrics[i].extraLabel...)
+			metrics[i].extraLabelValue = append([]string{s.Name}, metrics[i].extraLabelValue...)
+		}
+		if err := serverMetricDefs.send(ch, metrics); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serverConfigMetrics returns the limits, resources and settings of a server
+// from its raw pbs_statserver attributes.
+func serverConfigMetrics(attribs []utils.Attrib, logger log.Logger) []qstatMetric {
+	var metrics []qstatMetric
+
+	for _, attr := range attribs {
+		switch {
+		case isLimitAttribute(attr.Name):
+			limits, err := parseLimits(attr)
+			if err != nil {
+				logger.Warnln("Parse Server Limit Failed. ", err.Error())
+				continue
+			}
+			for _, l := range limits {
+				metrics = append(metrics, qstatMetric{
+					name:            "limit",
+					value:           l.value,
+					metricType:      prometheus.GaugeValue,
+					extraLabel:      limitLabels,
+					extraLabelValue: []string{l.attribute, l.resource, l.entityType, l.entity},
+				})
+			}
+		case serverResourceAttributes[attr.Name]:
+			v, ok := parseResourceValue(attr.Value)
+			if !ok || attr.Resource == "" {
+				continue
+			}
+			metrics = append(metrics, qstatMetric{
+				name:            attr.Name,
+				value:           v,
+				metricType:      prometheus.GaugeValue,
+				extraLabel:      []string{"Resource"},
+				extraLabelValue: []string{attr.Resource},
+			})
+		case serverBoolAttributes[attr.Name]:
+			metrics = append(metrics, qstatMetric{
+				name:       attr.Name,
+				value:      parseBool(attr.Value),
+				metricType: prometheus.GaugeValue,
+			})
+		case strings.HasPrefix(attr.Name, "acl_") && strings.HasSuffix(attr.Name, "_enable"):
+			metrics = append(metrics, qstatMetric{
+				name:            "acl_enable",
+				value:           parseBool(attr.Value),
+				metricType:      prometheus.GaugeValue,
+				extraLabel:      []string{"Acl"},
+				extraLabelValue: []string{strings.TrimSuffix(attr.Name, "_enable")},
+			})
+		case attr.Name == "backfill_depth":
+			v, ok := parseResourceValue(attr.Value)
+			if !ok {
+				continue
+			}
+			metrics = append(metrics, qstatMetric{
+				name:       "backfill_depth",
+				value:      v,
+				metricType: prometheus.GaugeValue,
+			})
+		case attr.Name == "scheduler_iteration":
+			v, ok := parseDuration(attr.Value)
+			if !ok {
+				continue
+			}
+			metrics = append(metrics, qstatMetric{
+				name:       "scheduler_iteration_seconds",
+				value:      v,
+				metricType: prometheus.GaugeValue,
+			})
+		}
+	}
+
+	return metrics
+}
+
+// configHash hashes the configuration attributes of the servers and queues.
+// State attributes such as job counts are ignored, so the hash only changes
+// when qmgr settings change.
+func configHash(servers, queues []utils.BatchStatus) [sha256.Size]byte {
+	var lines []string
+	for kind, batch := range map[string][]utils.BatchStatus{"server": servers, "queue": queues} {
+		for _, bs := range batch {
+			for _, attr := range bs.Attributes {
+				if volatileAttributes[attr.Name] {
+					continue
+				}
+				lines = append(lines, fmt.Sprintf("%s %s %s.%s=%s", kind, bs.Name, attr.Name, attr.Resource, attr.Value))
+			}
+		}
+	}
+	sort.Strings(lines)
+	return sha256.Sum256([]byte(strings.Join(lines, "\n")))
+}
+
+// attribute returns the value of the named attribute, or "" if it is unset.
+func attribute(attribs []utils.Attrib, name string) string {
+	for _, attr := range attribs {
+		if attr.Name == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/prometheus/common/log"
+)
+
+func TestConfigHash(t *testing.T) {
+	servers := []utils.BatchStatus{{Name: "pbs1", Attributes: []utils.Attrib{
+		{Name: "scheduling", Value: "True"},
+		{Name: "max_run", Value: "[u:PBS_GENERIC=20]"},
+		{Name: "total_jobs", Value: "10"},
+		{Name: "resources_assigned", Resource: "ncpus", Value: "64"},
+	}}}
+	queues := []utils.BatchStatus{{Name: "workq", Attributes: []utils.Attrib{
+		{Name: "queue_type", Value: "Execution"},
+		{Name: "state_count", Value: "Transit:0 Queued:3"},
+	}}}
+	hash := configHash(servers, queues)
+
+	// Volatile attributes change with the jobs, not the configuration.
+	changed := []utils.BatchStatus{{Name: "pbs1", Attributes: []utils.Attrib{
+		{Name: "scheduling", Value: "True"},
+		{Name: "max_run", Value: "[u:PBS_GENERIC=20]"},
+		{Name: "total_jobs", Value: "12"},
+		{Name: "resources_assigned", Resource: "ncpus", Value: "32"},
+	}}}
+	if configHash(changed, queues) != hash {
+		t.Error("hash changed with volatile attributes")
+	}
+
+	// The order of the attributes and objects doesn't matter.
+	reordered := []utils.BatchStatus{{Name: "pbs1", Attributes: []utils.Attrib{
+		{Name: "max_run", Value: "[u:PBS_GENERIC=20]"},
+		{Name: "scheduling", Value: "True"},
+	}}}
+	if configHash(reordered, queues) != hash {
+		t.Error("hash changed with the order of the attributes")
+	}
+	twoQueues := append(queues, utils.BatchStatus{Name: "long", Attributes: []utils.Attrib{{Name: "queue_type", Value: "Execution"}}})
+	if configHash(servers, twoQueues) != configHash(servers, []utils.BatchStatus{twoQueues[1], twoQueues[0]}) {
+		t.Error("hash changed with the order of the queues")
+	}
+
+	for _, other := range [][]utils.BatchStatus{
+		{{Name: "pbs1", Attributes: []utils.Attrib{{Name: "scheduling", Value: "False"}, {Name: "max_run", Value: "[u:PBS_GENERIC=20]"}}}},
+		{{Name: "pbs1", Attributes: []utils.Attrib{{Name: "scheduling", Value: "True"}, {Name: "max_run", Value: "[u:PBS_GENERIC=10]"}}}},
+	} {
+		if configHash(other, queues) == hash {
+			t.Errorf("%+v: hash didn't change with the configuration", other)
+		}
+	}
+	// The same attribute on a queue is a different setting.
+	if configHash(nil, []utils.BatchStatus{{Name: "pbs1", Attributes: servers[0].Attributes}}) == hash {
+		t.Error("hash doesn't tell server from queue attributes")
+	}
+}
+
+func TestServerConfigMetrics(t *testing.T) {
+	attribs := []utils.Attrib{
+		{Name: "max_run", Value: "[o:PBS_ALL=100],[u:PBS_GENERIC=20]"},
+		{Name: "max_queued", Value: "[u:PBS_GENERIC"},
+		{Name: "resources_available", Resource: "ncpus", Value: "1024"},
+		{Name: "resources_max", Resource: "mem", Value: "512gb"},
+		{Name: "resources_default", Resource: "arch", Value: "linux"},
+		{Name: "default_chunk", Resource: "ncpus", Value: "1"},
+		{Name: "flatuid", Value: "True"},
+		{Name: "node_group_enable", Value: "False"},
+		{Name: "acl_host_enable", Value: "True"},
+		{Name: "backfill_depth", Value: "2"},
+		{Name: "scheduler_iteration", Value: "00:10:00"},
+		{Name: "scheduling", Value: "True"},
+	}
+	var got []string
+	for _, m := range serverConfigMetrics(attribs, log.NewNopLogger()) {
+		got = append(got, fmt.Sprintf("%s%v %v", m.name, m.extraLabelValue, m.value))
+	}
+	want := []string{
+		"limit[max_run  overall PBS_ALL] 100",
+		"limit[max_run  user PBS_GENERIC] 20",
+		"resources_available[ncpus] 1024",
+		fmt.Sprintf("resources_max[mem] %v", float64(512<<30)),
+		"default_chunk[ncpus] 1",
+		"flatuid[] 1",
+		"node_group_enable[] 0",
+		"acl_enable[acl_host] 1",
+		"backfill_depth[] 2",
+		"scheduler_iteration_seconds[] 600",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,154 @@
+package collector
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/go_pbspro/utils"
+)
+
+// pbsSource returns the status of a PBS server. Collectors open one per
+// Update and close it when they are done.
+type pbsSource interface {
+	ServerState() ([]qstat.QstatServerInfo, error)
+	QueueState() ([]qstat.QstatQueueInfo, error)
+	NodeState() ([]qstat.QstatNodeInfo, error)
+	JobsState() ([]qstat.QstatJobsInfo, error)
+	// ServerAttributes, QueueAttributes and NodeAttributes return the raw
+	// attributes, for the ones missing from the typed state.
+	ServerAttributes() ([]utils.BatchStatus, error)
+	QueueAttributes() ([]utils.BatchStatus, error)
+	NodeAttributes() ([]utils.BatchStatus, error)
+	// JobAttributes returns the jobRawAttributes of all jobs, named by
+	// their job id, which the typed state lacks.
+	JobAttributes() ([]utils.BatchStatus, error)
+	Close() error
+}
+
+// jobRawAttributes are the job attributes returned by JobAttributes.
+// Job_Owner, Job_Name and ctime match them with the typed state.
+var jobRawAttributes = []string{"Job_Owner", "Job_Name", "ctime", "job_state", "queue", "exec_host", "exec_vnode", "Resource_List", "resources_used", "estimated"}
+
+// newSource opens a pbsSource for the server. Every call of the source is
+// instrumented with the request metrics. The source replays snapshots
+// instead of querying PBS with --pbs.replay-dir and records them with
+// --pbs.record-dir.
+var newSource = func(server PBSServer) (pbsSource, error) {
+	open := connectPBS
+	if *replayDir != "" {
+		open = replayOf(*replayDir).open
+	}
+	src, err := newInstrumentedSource(server, open)
+	if err != nil || *recordDir == "" {
+		return src, err
+	}
+	return newRecordingSource(server, src, *recordDir), nil
+}
+
+// pbsError is an error of a PBS API call with the pbs_errno it set.
+type pbsError struct {
+	code int
+	err  error
+}
+
+func (e *pbsError) Error() string {
+	return e.err.Error()
+}
+
+// pbsCall runs a PBS API call and returns its error, if any, with the
+// pbs_errno it set. The goroutine stays on its thread, which pbs_errno is
+// local to, until the error number is read.
+func pbsCall(f func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := f(); err != nil {
+		return &pbsError{code: pbsErrno(), err: err}
+	}
+	return nil
+}
+
+// qstatSource reads the state of a PBS server with go_pbspro.
+type qstatSource struct {
+	q *qstat.Qstat
+}
+
+func connectPBS(server PBSServer) (pbsSource, error) {
+	q, err := qstat.NewQstat(server.Address)
+	if err != nil {
+		return nil, fmt.Errorf("create qstat: %s", err)
+	}
+	q.SetAttribs(nil)
+	q.SetExtend("")
+	if err := pbsCall(q.ConnectPBS); err != nil {
+		e := err.(*pbsError)
+		e.err = fmt.Errorf("connect PBS server %s: %s", server.Address, e.err)
+		return nil, e
+	}
+	return &qstatSource{q: q}, nil
+}
+
+func (s *qstatSource) ServerState() ([]qstat.QstatServerInfo, error) {
+	err := pbsCall(s.q.PbsServerState)
+	return s.q.ServerState, err
+}
+
+func (s *qstatSource) QueueState() ([]qstat.QstatQueueInfo, error) {
+	err := pbsCall(s.q.PbsQueueState)
+	return s.q.QueueState, err
+}
+
+func (s *qstatSource) NodeState() ([]qstat.QstatNodeInfo, error) {
+	err := pbsCall(s.q.PbsNodeState)
+	return s.q.NodeState, err
+}
+
+func (s *qstatSource) JobsState() ([]qstat.QstatJobsInfo, error) {
+	err := pbsCall(s.q.PbsJobsState)
+	if e, ok := err.(*pbsError); ok && e.code == 0 {
+		// pbs_selstat returns no status without an error when there
+		// are no jobs.
+		return nil, nil
+	}
+	return s.q.JobsState, err
+}
+
+func (s *qstatSource) ServerAttributes() ([]utils.BatchStatus, error) {
+	var bs []utils.BatchStatus
+	err := pbsCall(func() (err error) {
+		bs, err = statServerRaw(s.q.Handle)
+		return err
+	})
+	return bs, err
+}
+
+func (s *qstatSource) QueueAttributes() ([]utils.BatchStatus, error) {
+	var bs []utils.BatchStatus
+	err := pbsCall(func() (err error) {
+		bs, err = statQueueRaw(s.q.Handle, "")
+		return err
+	})
+	return bs, err
+}
+
+func (s *qstatSource) NodeAttributes() ([]utils.BatchStatus, error) {
+	var bs []utils.BatchStatus
+	err := pbsCall(func() (err error) {
+		bs, err = statNodeRaw(s.q.Handle)
+		return err
+	})
+	return bs, err
+}
+
+func (s *qstatSource) JobAttributes() ([]utils.BatchStatus, error) {
+	var bs []utils.BatchStatus
+	err := pbsCall(func() (err error) {
+		bs, err = statJobRaw(s.q.Handle, jobRawAttributes)
+		return err
+	})
+	return bs, err
+}
+
+func (s *qstatSource) Close() error {
+	return pbsCall(s.q.DisconnectPBS)
+}
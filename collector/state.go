@@ -0,0 +1,227 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/go_pbspro/utils"
+)
+
+// State is the state of a PBS server at a point in time, for the API and
+// pages that show the cluster rather than metrics.
+type State struct {
+	Server  PBSServer
+	Time    time.Time
+	Servers []qstat.QstatServerInfo
+	Queues  []qstat.QstatQueueInfo
+	Nodes   []qstat.QstatNodeInfo
+	// NodeAttributes are the raw attributes of the nodes, for the ones
+	// missing from Nodes such as queue and custom resources.
+	NodeAttributes []utils.BatchStatus
+	// JobAttributes are the raw attributes of the jobs, named by their job
+	// ID, which Jobs takes the IDs from.
+	JobAttributes []utils.BatchStatus
+	// jobs are not redacted, use Jobs.
+	jobs []qstat.QstatJobsInfo
+}
+
+// Job is a job of a State with its ID, which qstat.QstatJobsInfo lacks.
+type Job struct {
+	ID string `json:"job_id"`
+	qstat.QstatJobsInfo
+}
+
+// NewState returns the state of a server made of the given objects.
+func NewState(server PBSServer, t time.Time, servers []qstat.QstatServerInfo, queues []qstat.QstatQueueInfo, nodes []qstat.QstatNodeInfo, jobs []qstat.QstatJobsInfo) *State {
+	return &State{Server: server, Time: t, Servers: servers, Queues: queues, Nodes: nodes, jobs: jobs}
+}
+
+// JobFilter selects jobs. A job matches if it matches one of the values of
+// every non-empty field.
+type JobFilter struct {
+	// Users match the user part of the job owner, user@host.
+	Users  []string
+	Queues []string
+	States []string
+}
+
+// Jobs returns the jobs matching the filter, with their IDs and their labels
+// redacted by the current redaction policy. The filter applies to the values
+// before redaction, so filtering by user is refused if the policy drops or
+// hashes the job owner.
+func (s *State) Jobs(f JobFilter) ([]Job, error) {
+	r := getRedactor()
+	if len(f.Users) > 0 && r.hides("JobOwner") {
+		return nil, fmt.Errorf("jobs can't be filtered by user, JobOwner is redacted")
+	}
+	ids := jobIDs(s.jobs, s.JobAttributes)
+	jobs := []Job{}
+	for i, j := range s.jobs {
+		if f.matches(j) {
+			jobs = append(jobs, Job{ID: ids[i], QstatJobsInfo: r.job(j)})
+		}
+	}
+	return jobs, nil
+}
+
+// jobIDs returns the IDs of the jobs, the names of their raw attributes.
+// Jobs are matched by owner, name and creation time, and among the jobs
+// sharing those in order, as PBS returns the jobs in the same order to
+// every call. Jobs missing from the raw attributes get no ID.
+func jobIDs(jobs []qstat.QstatJobsInfo, attribs []utils.BatchStatus) []string {
+	key := func(owner, name string, ctime int64) string {
+		return fmt.Sprintf("%s\x00%s\x00%d", owner, name, ctime)
+	}
+	byKey := make(map[string][]string)
+	for _, bs := range attribs {
+		ctime, _ := strconv.ParseInt(attribute(bs.Attributes, "ctime"), 10, 64)
+		k := key(attribute(bs.Attributes, "Job_Owner"), attribute(bs.Attributes, "Job_Name"), ctime)
+		byKey[k] = append(byKey[k], bs.Name)
+	}
+	ids := make([]string, len(jobs))
+	for i, j := range jobs {
+		k := key(j.JobOwner, j.JobName, j.Ctime)
+		if len(byKey[k]) > 0 {
+			ids[i], byKey[k] = byKey[k][0], byKey[k][1:]
+		}
+	}
+	return ids
+}
+
+// UserJobs returns the jobs matching the filter by the user part of their
+// owner, so that the jobs a user submitted from different hosts are
+// grouped together. The users are redacted by the JobOwner rule after
+// grouping and the jobs like Jobs returns them.
+func (s *State) UserJobs(f JobFilter) (map[string][]qstat.QstatJobsInfo, error) {
+	r := getRedactor()
+	if len(f.Users) > 0 && r.hides("JobOwner") {
+		return nil, fmt.Errorf("jobs can't be filtered by user, JobOwner is redacted")
+	}
+	byUser := make(map[string][]qstat.QstatJobsInfo)
+	for _, j := range s.jobs {
+		if f.matches(j) {
+			user := r.value("JobOwner", jobUser(j))
+			byUser[user] = append(byUser[user], r.job(j))
+		}
+	}
+	return byUser, nil
+}
+
+// jobUser returns the user part of the owner of a job, user@host.
+func jobUser(j qstat.QstatJobsInfo) string {
+	if i := strings.Index(j.JobOwner, "@"); i >= 0 {
+		return j.JobOwner[:i]
+	}
+	return j.JobOwner
+}
+
+func (f JobFilter) matches(j qstat.QstatJobsInfo) bool {
+	return matches(f.Users, jobUser(j)) && matches(f.Queues, j.Queue) && matches(f.States, j.JobState)
+}
+
+func matches(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// stateEntry caches the state of a server. Its mutex makes concurrent
+// callers wait for one fetch instead of each querying PBS.
+type stateEntry struct {
+	mtx   sync.Mutex
+	state *State
+}
+
+var (
+	statesMtx sync.Mutex
+	// states is keyed by server name and address.
+	states = make(map[PBSServer]*stateEntry)
+)
+
+// stateEntryOf returns the cache entry of the server.
+func stateEntryOf(server PBSServer) *stateEntry {
+	statesMtx.Lock()
+	defer statesMtx.Unlock()
+	e, ok := states[server]
+	if !ok {
+		e = &stateEntry{}
+		states[server] = e
+	}
+	return e
+}
+
+// storeState caches a state read by a scrape, unless a newer one is cached.
+func storeState(state *State) {
+	e := stateEntryOf(state.Server)
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.state == nil || e.state.Time.Before(state.Time) {
+		e.state = state
+	}
+}
+
+// CurrentState returns the state of the server. It is fetched from PBS
+// unless the cached state, read by the last scrape or fetch, is younger
+// than maxAge.
+func CurrentState(server PBSServer, maxAge time.Duration) (*State, error) {
+	e := stateEntryOf(server)
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.state != nil && time.Since(e.state.Time) < maxAge {
+		return e.state, nil
+	}
+	state, err := fetchState(server)
+	if err != nil {
+		return nil, err
+	}
+	e.state = state
+	return state, nil
+}
+
+func fetchState(server PBSServer) (*State, error) {
+	src, err := newSource(server)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	t := time.Now()
+	servers, err := src.ServerState()
+	if err != nil {
+		return nil, fmt.Errorf("server state: %s", err)
+	}
+	queues, err := src.QueueState()
+	if err != nil {
+		return nil, fmt.Errorf("queue state: %s", err)
+	}
+	nodes, err := src.NodeState()
+	if err != nil {
+		return nil, fmt.Errorf("node state: %s", err)
+	}
+	nodeAttrs, err := src.NodeAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("node attributes: %s", err)
+	}
+	jobs, err := src.JobsState()
+	if err != nil {
+		return nil, fmt.Errorf("jobs state: %s", err)
+	}
+	jobAttrs, err := src.JobAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("job attributes: %s", err)
+	}
+	s := NewState(server, t, servers, queues, nodes, jobs)
+	s.NodeAttributes = nodeAttrs
+	s.JobAttributes = jobAttrs
+	return s, nil
+}
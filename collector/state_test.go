@@ -0,0 +1,216 @@
+package collector
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+func TestCurrentStateCache(t *testing.T) {
+	opened := 0
+	src := &fakeSource{nodes: []qstat.QstatNodeInfo{{NodeName: "n1"}}}
+	withOpen(t, func(PBSServer) (pbsSource, error) {
+		opened++
+		return src, nil
+	})
+	server := PBSServer{Name: "cache", Address: "cache"}
+
+	for i := 0; i < 2; i++ {
+		s, err := CurrentState(server, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.Nodes) != 1 || s.Server != server {
+			t.Errorf("unexpected state %+v", s)
+		}
+	}
+	if opened != 1 {
+		t.Errorf("PBS queried %d times, want the state to be cached", opened)
+	}
+	if _, err := CurrentState(server, 0); err != nil {
+		t.Fatal(err)
+	}
+	if opened != 2 {
+		t.Errorf("PBS queried %d times, want the expired state to be fetched", opened)
+	}
+
+	src.err = errors.New("node state failed")
+	if _, err := CurrentState(server, 0); err == nil {
+		t.Error("expected error")
+	}
+	s, err := CurrentState(server, time.Hour)
+	if err != nil || len(s.Nodes) != 1 {
+		t.Errorf("failed fetch replaced the cached state: %v, %v", s, err)
+	}
+}
+
+func TestStateJobs(t *testing.T) {
+	t.Cleanup(func() { SetRedaction(Redaction{}) })
+	s := NewState(PBSServer{Name: "pbs1"}, time.Now(), nil, nil, nil, []qstat.QstatJobsInfo{
+		{JobName: "a", JobOwner: "alice@login1", Queue: "workq", JobState: "R", VariableList: "SECRET=1"},
+		{JobName: "b", JobOwner: "bob@login1", Queue: "workq", JobState: "Q"},
+		{JobName: "c", JobOwner: "alice@login2", Queue: "gpu", JobState: "H"},
+	})
+
+	for _, test := range []struct {
+		filter JobFilter
+		want   []string
+	}{
+		{JobFilter{}, []string{"a", "b", "c"}},
+		{JobFilter{Users: []string{"alice"}}, []string{"a", "c"}},
+		{JobFilter{Users: []string{"alice"}, Queues: []string{"workq"}}, []string{"a"}},
+		{JobFilter{States: []string{"Q", "H"}}, []string{"b", "c"}},
+		{JobFilter{Users: []string{"carol"}}, nil},
+	} {
+		jobs, err := s.Jobs(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, j := range jobs {
+			names = append(names, j.JobName)
+			if j.VariableList != "" {
+				t.Errorf("job %s: VariableList not redacted", j.JobName)
+			}
+			if j.JobOwner != "alice_login1" && j.JobOwner != "bob_login1" && j.JobOwner != "alice_login2" {
+				t.Errorf("job %s: JobOwner %q not masked", j.JobName, j.JobOwner)
+			}
+		}
+		if strings.Join(names, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%+v: got jobs %v, want %v", test.filter, names, test.want)
+		}
+	}
+
+	if err := SetRedaction(Redaction{Rules: []RedactionRule{{Label: "JobOwner", Action: RedactHash}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Jobs(JobFilter{Users: []string{"alice"}}); err == nil {
+		t.Error("filtering by a hashed job owner succeeded")
+	}
+	if jobs, err := s.Jobs(JobFilter{}); err != nil || len(jobs) != 3 || jobs[0].JobOwner == "alice@login1" {
+		t.Errorf("got %v, %v, want hashed owners", jobs, err)
+	}
+}
+
+func TestJobIDs(t *testing.T) {
+	raw := func(id, owner, name, ctime string) utils.BatchStatus {
+		return utils.BatchStatus{Name: id, Attributes: []utils.Attrib{
+			{Name: "Job_Owner", Value: owner},
+			{Name: "Job_Name", Value: name},
+			{Name: "ctime", Value: ctime},
+		}}
+	}
+	jobs := []qstat.QstatJobsInfo{
+		{JobName: "a", JobOwner: "alice@login1", Ctime: 1700000000},
+		{JobName: "loop", JobOwner: "bob@login1", Ctime: 1700000060},
+		{JobName: "loop", JobOwner: "bob@login1", Ctime: 1700000060},
+		// Submitted between the two calls.
+		{JobName: "new", JobOwner: "carol@login1", Ctime: 1700000120},
+	}
+	attribs := []utils.BatchStatus{
+		raw("2.pbs1", "bob@login1", "loop", "1700000060"),
+		raw("1.pbs1", "alice@login1", "a", "1700000000"),
+		raw("3.pbs1", "bob@login1", "loop", "1700000060"),
+	}
+	want := []string{"1.pbs1", "2.pbs1", "3.pbs1", ""}
+	if got := jobIDs(jobs, attribs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	s := NewState(PBSServer{Name: "pbs1"}, time.Now(), nil, nil, nil, jobs)
+	s.JobAttributes = attribs
+	got, err := s.Jobs(JobFilter{Users: []string{"alice"}})
+	if err != nil || len(got) != 1 || got[0].ID != "1.pbs1" {
+		t.Errorf("got %v, %v, want job 1.pbs1", got, err)
+	}
+}
+
+// countingSource counts the calls of a fakeSource.
+type countingSource struct {
+	*fakeSource
+	mtx    sync.Mutex
+	calls  map[string]int
+	closed int
+}
+
+func (s *countingSource) count(call string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.calls[call]++
+}
+
+func (s *countingSource) NodeAttributes() ([]utils.BatchStatus, error) {
+	s.count(callNodeAttributes)
+	return s.fakeSource.NodeAttributes()
+}
+
+func (s *countingSource) JobsState() ([]qstat.QstatJobsInfo, error) {
+	s.count(callJobsState)
+	return s.fakeSource.JobsState()
+}
+
+func (s *countingSource) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.closed++
+	return nil
+}
+
+func TestScrapeSharesState(t *testing.T) {
+	opened := 0
+	src := &countingSource{
+		fakeSource: &fakeSource{
+			servers: []qstat.QstatServerInfo{{ServerName: "shared"}},
+			nodes:   []qstat.QstatNodeInfo{{NodeName: "n1"}},
+			jobs:    []qstat.QstatJobsInfo{{JobName: "j1"}},
+		},
+		calls: make(map[string]int),
+	}
+	withOpen(t, func(PBSServer) (pbsSource, error) {
+		opened++
+		return src, nil
+	})
+	server := PBSServer{Name: "shared", Address: "shared"}
+	n := PBSCollector{Server: server, Collectors: make(map[string]Collector), logger: log.NewNopLogger()}
+	for name, factory := range factories {
+		c, err := factory(server, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.Collectors[name] = c
+	}
+	ch := make(chan prometheus.Metric)
+	go func() {
+		for range ch {
+		}
+	}()
+	n.Collect(ch)
+	close(ch)
+
+	if opened != 1 || src.closed != 1 {
+		t.Errorf("scrape connected %d and disconnected %d times, want once", opened, src.closed)
+	}
+	// The job and node collectors both read the node attributes.
+	if src.calls[callNodeAttributes] != 1 || src.calls[callJobsState] != 1 {
+		t.Errorf("calls made more than once per scrape: %v", src.calls)
+	}
+
+	s, err := CurrentState(server, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened != 1 {
+		t.Error("CurrentState queried PBS despite a recent scrape")
+	}
+	if len(s.Nodes) != 1 || len(s.jobs) != 1 {
+		t.Errorf("unexpected state %+v", s)
+	}
+}
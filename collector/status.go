@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ScrapeStatus is the outcome of the last run of a collector against a PBS
+// server.
+type ScrapeStatus struct {
+	Server    string
+	Collector string
+	Time      time.Time
+	Duration  time.Duration
+	// Err is the error of the collector, nil if it succeeded.
+	Err error
+}
+
+var (
+	statusMtx sync.RWMutex
+	// lastScrapes is keyed by server name and collector name.
+	lastScrapes = make(map[[2]string]ScrapeStatus)
+	// lastContacts holds the time of the last successful contact with each
+	// PBS server, keyed by server name.
+	lastContacts = make(map[string]time.Time)
+)
+
+func recordScrape(s ScrapeStatus) {
+	statusMtx.Lock()
+	defer statusMtx.Unlock()
+	lastScrapes[[2]string{s.Server, s.Collector}] = s
+	if s.Err == nil {
+		recordContact(s.Server, s.Time.Add(s.Duration))
+	}
+}
+
+// recordContact must be called with statusMtx held.
+func recordContact(server string, t time.Time) {
+	if t.After(lastContacts[server]) {
+		lastContacts[server] = t
+	}
+}
+
+// PruneStatus forgets the scrapes, contacts and cached states of servers that
+// are not in servers, e.g. servers removed from the configuration.
+func PruneStatus(servers []PBSServer) {
+	names := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		names[server.Name] = true
+	}
+
+	statusMtx.Lock()
+	for key := range lastScrapes {
+		if !names[key[0]] {
+			delete(lastScrapes, key)
+		}
+	}
+	for server := range lastContacts {
+		if !names[server] {
+			delete(lastContacts, server)
+		}
+	}
+	statusMtx.Unlock()
+
+	statesMtx.Lock()
+	for server := range states {
+		if !names[server.Name] {
+			delete(states, server)
+		}
+	}
+	statesMtx.Unlock()
+
+	errorLimiter.prune(names)
+}
+
+// FailedScrapes returns the collectors of the server whose last scrape
+// failed within maxAge, sorted by collector.
+func FailedScrapes(server PBSServer, maxAge time.Duration) []ScrapeStatus {
+	var failed []ScrapeStatus
+	for _, s := range ScrapeStatuses() {
+		if s.Server == server.Name && s.Err != nil && time.Since(s.Time) <= maxAge {
+			failed = append(failed, s)
+		}
+	}
+	return failed
+}
+
+// ScrapeStatuses returns the last scrape of every collector and server,
+// sorted by server and collector.
+func ScrapeStatuses() []ScrapeStatus {
+	statusMtx.RLock()
+	defer statusMtx.RUnlock()
+	statuses := make([]ScrapeStatus, 0, len(lastScrapes))
+	for _, s := range lastScrapes {
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Server != statuses[j].Server {
+			return statuses[i].Server < statuses[j].Server
+		}
+		return statuses[i].Collector < statuses[j].Collector
+	})
+	return statuses
+}
+
+// LastContact returns when a collector last succeeded against the server,
+// or when Ping last reached it. It is the zero time if neither happened.
+func LastContact(server PBSServer) time.Time {
+	statusMtx.RLock()
+	defer statusMtx.RUnlock()
+	return lastContacts[server.Name]
+}
+
+// Ping connects to the PBS server and disconnects again. A successful ping
+// counts as a contact for LastContact.
+func Ping(server PBSServer) error {
+	src, err := newSource(server)
+	if err != nil {
+		return err
+	}
+	src.Close()
+
+	statusMtx.Lock()
+	defer statusMtx.Unlock()
+	recordContact(server.Name, time.Now())
+	return nil
+}
@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+func TestScrapeStatus(t *testing.T) {
+	server := PBSServer{Name: "status-test", Address: "pbs1"}
+	begin := time.Now()
+
+	recordScrape(ScrapeStatus{Server: server.Name, Collector: "server", Time: begin, Duration: time.Second})
+	recordScrape(ScrapeStatus{Server: server.Name, Collector: "qstat", Time: begin.Add(time.Minute), Err: errors.New("connect failed")})
+
+	if got, want := LastContact(server), begin.Add(time.Second); !got.Equal(want) {
+		t.Errorf("last contact: got %s, want %s", got, want)
+	}
+
+	var statuses []ScrapeStatus
+	for _, s := range ScrapeStatuses() {
+		if s.Server == server.Name {
+			statuses = append(statuses, s)
+		}
+	}
+	if len(statuses) != 2 || statuses[0].Collector != "qstat" || statuses[1].Collector != "server" {
+		t.Fatalf("unexpected statuses %+v", statuses)
+	}
+	if statuses[0].Err == nil || statuses[1].Err != nil {
+		t.Errorf("unexpected errors in %+v", statuses)
+	}
+
+	if !LastContact(PBSServer{Name: "never-scraped"}).IsZero() {
+		t.Error("expected no contact with an unknown server")
+	}
+}
+
+func TestPruneStatus(t *testing.T) {
+	kept := PBSServer{Name: "prune-kept", Address: "pbs1"}
+	removed := PBSServer{Name: "prune-removed", Address: "pbs2"}
+	begin := time.Now()
+	for _, server := range []PBSServer{kept, removed} {
+		recordScrape(ScrapeStatus{Server: server.Name, Collector: "server", Time: begin})
+		recordScrape(ScrapeStatus{Server: server.Name, Collector: "qstat", Time: begin, Err: errors.New("stat nodes: timeout")})
+		errorLimiter.allow(server.Name, "qstat", errors.New("stat nodes: timeout"))
+	}
+
+	PruneStatus([]PBSServer{kept})
+
+	if LastContact(kept).IsZero() {
+		t.Error("expected the contact with the configured server to be kept")
+	}
+	if !LastContact(removed).IsZero() {
+		t.Error("expected the contact with the removed server to be pruned")
+	}
+	if got := FailedScrapes(kept, time.Minute); len(got) != 1 || got[0].Collector != "qstat" {
+		t.Errorf("unexpected failed scrapes of the configured server %+v", got)
+	}
+	if got := FailedScrapes(removed, time.Minute); len(got) != 0 {
+		t.Errorf("expected the scrapes of the removed server to be pruned, got %+v", got)
+	}
+	if _, ok := errorLimiter.allow(removed.Name, "qstat", errors.New("stat nodes: timeout")); !ok {
+		t.Error("expected the logged errors of the removed server to be pruned")
+	}
+}
+
+func TestProbeNotRecorded(t *testing.T) {
+	server := PBSServer{Name: "probe-target", Address: "probe-target", Probe: true}
+	n := PBSCollector{
+		Server:     server,
+		Collectors: map[string]Collector{"failing": failingCollector{}},
+		logger:     log.Base(),
+	}
+	ch := make(chan prometheus.Metric, 10)
+	n.Collect(ch)
+	close(ch)
+
+	for _, s := range ScrapeStatuses() {
+		if s.Server == server.Name {
+			t.Errorf("unexpected scrape status of a probe target %+v", s)
+		}
+	}
+}
+
+type failingCollector struct{}
+
+func (failingCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (failingCollector) Update(src pbsSource, ch chan<- prometheus.Metric) error {
+	return errors.New("connect failed")
+}
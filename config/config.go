@@ -0,0 +1,164 @@
+// Package config holds the configuration file of the pbspro_exporter.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/gsangwell/pbspro_exporter/collector"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the content of the --config.file.
+type Config struct {
+	// Servers are the PBS servers scraped on /metrics. They replace the
+	// servers given with --collector.pbspro.url when set.
+	Servers []Server `yaml:"servers"`
+	// Collectors enables or disables collectors by name, overriding their
+	// --collector.<name> flag.
+	Collectors map[string]bool `yaml:"collectors"`
+	// Modules are selected with the module parameter of /probe.
+	Modules map[string]Module `yaml:"modules"`
+	// Redaction controls which job attributes reach the job labels.
+	Redaction Redaction `yaml:"redaction"`
+}
+
+// Server is a PBS server scraped by the exporter.
+type Server struct {
+	// Name is used as the cluster label. Defaults to the address.
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"`
+}
+
+// Module defines how a /probe target is scraped.
+type Module struct {
+	// Collectors are the collectors of the probe, whether their
+	// --collector.<name> flag enables them or not. All enabled collectors
+	// are used when it is empty.
+	Collectors []string `yaml:"collectors"`
+	// Labels are added to every metric of the probe. A cluster label here
+	// overrides the default cluster label, which is the target. Labels of
+	// the metrics themselves can't be used.
+	Labels map[string]string `yaml:"labels"`
+	// Redaction is applied to the job labels of the probe after the
+	// redaction of the exporter.
+	Redaction Redaction `yaml:"redaction"`
+}
+
+// Redaction is the redaction policy of the job labels. Its rules are
+// applied after the --collector.qstat.redact rules.
+type Redaction struct {
+	// LabelMaxLength overrides --collector.qstat.label-max-length.
+	LabelMaxLength *int            `yaml:"label_max_length"`
+	Rules          []RedactionRule `yaml:"rules"`
+}
+
+// RedactionRule redacts a job label. Action is keep, drop, hash or mask;
+// mask replaces every match of Regex with Replacement.
+type RedactionRule struct {
+	Label       string `yaml:"label"`
+	Action      string `yaml:"action"`
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"`
+}
+
+// LoadFile parses and validates the given configuration file.
+func LoadFile(filename string) (*Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Load(content)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", filename, err)
+	}
+	return cfg, nil
+}
+
+// Load parses and validates a configuration. Unknown fields are an error.
+func Load(content []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	names := make(map[string]bool)
+	for i := range c.Servers {
+		s := &c.Servers[i]
+		if s.Address == "" {
+			return fmt.Errorf("servers[%d]: missing address", i)
+		}
+		if s.Name == "" {
+			s.Name = s.Address
+		}
+		if names[s.Name] {
+			return fmt.Errorf("servers[%d]: duplicate server name %q", i, s.Name)
+		}
+		names[s.Name] = true
+	}
+
+	for name := range c.Collectors {
+		if !collector.CollectorExists(name) {
+			return fmt.Errorf("collectors: unknown collector %q", name)
+		}
+	}
+	for name, module := range c.Modules {
+		for _, col := range module.Collectors {
+			if !collector.CollectorExists(col) {
+				return fmt.Errorf("module %s: unknown collector %q", name, col)
+			}
+		}
+		for l := range module.Labels {
+			if !model.LabelName(l).IsValid() {
+				return fmt.Errorf("module %s: invalid label name %q", name, l)
+			}
+		}
+		if err := collector.CheckLabels(module.Labels); err != nil {
+			return fmt.Errorf("module %s: %s", name, err)
+		}
+		if err := module.Redaction.validate(fmt.Sprintf("module %s: redaction", name)); err != nil {
+			return err
+		}
+	}
+
+	return c.Redaction.validate("redaction")
+}
+
+// validate checks the redaction policy. Errors are prefixed with field.
+func (r Redaction) validate(field string) error {
+	if l := r.LabelMaxLength; l != nil && *l < 0 {
+		return fmt.Errorf("%s: invalid label_max_length %d", field, *l)
+	}
+	for i, rule := range r.Rules {
+		if rule.Label == "" {
+			return fmt.Errorf("%s.rules[%d]: missing label", field, i)
+		}
+		if !collector.IsJobLabel(rule.Label) {
+			return fmt.Errorf("%s.rules[%d]: unknown job label %q", field, i, rule.Label)
+		}
+		switch rule.Action {
+		case collector.RedactKeep, collector.RedactDrop, collector.RedactHash:
+			if rule.Regex != "" || rule.Replacement != "" {
+				return fmt.Errorf("%s.rules[%d]: regex and replacement are only valid with action mask", field, i)
+			}
+		case collector.RedactMask:
+			if rule.Regex == "" {
+				return fmt.Errorf("%s.rules[%d]: missing regex", field, i)
+			}
+			if _, err := regexp.Compile(rule.Regex); err != nil {
+				return fmt.Errorf("%s.rules[%d]: invalid regex: %s", field, i, err)
+			}
+		default:
+			return fmt.Errorf("%s.rules[%d]: unknown action %q", field, i, rule.Action)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	for _, c := range []struct {
+		name, content, err string
+	}{
+		{
+			name: "valid",
+			content: `
+servers:
+- {name: hpc1, address: pbs1.example.com}
+- {address: pbs2.example.com}
+collectors: {job: false, node: true}
+modules:
+  default: {collectors: [qstat, server], labels: {site: a}}
+  gpu:
+    labels: {cluster: gpu}
+    redaction: {rules: [{label: JobOwner, action: hash}]}
+`,
+		},
+		{
+			name:    "empty",
+			content: "",
+		},
+		{
+			name:    "unknown key",
+			content: "server: [{address: pbs1}]",
+			err:     "field server not found",
+		},
+		{
+			name:    "unknown server key",
+			content: "servers: [{address: pbs1, port: 15001}]",
+			err:     "field port not found",
+		},
+		{
+			name:    "missing address",
+			content: "servers: [{name: hpc1}]",
+			err:     "servers[0]: missing address",
+		},
+		{
+			name:    "duplicate server name",
+			content: "servers: [{name: hpc1, address: pbs1}, {name: hpc1, address: pbs2}]",
+			err:     `servers[1]: duplicate server name "hpc1"`,
+		},
+		{
+			name:    "duplicate default server name",
+			content: "servers: [{name: pbs1, address: pbs2}, {address: pbs1}]",
+			err:     `servers[1]: duplicate server name "pbs1"`,
+		},
+		{
+			name:    "unknown collector",
+			content: "collectors: {jobs: true}",
+			err:     `collectors: unknown collector "jobs"`,
+		},
+		{
+			name:    "unknown module collector",
+			content: "modules: {default: {collectors: [qstat, jobs]}}",
+			err:     `module default: unknown collector "jobs"`,
+		},
+		{
+			name:    "invalid module label",
+			content: "modules: {default: {labels: {site-name: a}}}",
+			err:     `module default: invalid label name "site-name"`,
+		},
+		{
+			name:    "module label of the metrics",
+			content: "modules: {default: {labels: {site: a, queue: b}}}",
+			err:     `module default: label "queue" is already used by the metrics`,
+		},
+		{
+			name:    "invalid module redaction",
+			content: "modules: {default: {redaction: {rules: [{label: Secret, action: drop}]}}}",
+			err:     `module default: redaction.rules[0]: unknown job label "Secret"`,
+		},
+	} {
+		cfg, err := Load([]byte(c.content))
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+		case c.err != "" && err == nil:
+			t.Errorf("%s: expected error %q", c.name, c.err)
+		case c.err != "" && !strings.Contains(err.Error(), c.err):
+			t.Errorf("%s: got error %q, want %q", c.name, err, c.err)
+		case c.name == "valid" && cfg.Servers[1].Name != "pbs2.example.com":
+			t.Errorf("%s: got server name %q, want the address", c.name, cfg.Servers[1].Name)
+		}
+	}
+}
+
+func TestLoadRedaction(t *testing.T) {
+	for _, c := range []struct {
+		name, content, err string
+	}{
+		{
+			name: "valid",
+			content: `
+redaction:
+  label_max_length: 64
+  rules:
+  - {label: VariableListPath, action: hash}
+  - {label: Comment, action: mask, regex: '\d+', replacement: N}
+`,
+		},
+		{
+			name:    "unknown label",
+			content: "redaction: {rules: [{label: Secret, action: drop}]}",
+			err:     `redaction.rules[0]: unknown job label "Secret"`,
+		},
+		{
+			name:    "missing label",
+			content: "redaction: {rules: [{action: drop}]}",
+			err:     "redaction.rules[0]: missing label",
+		},
+		{
+			name:    "unknown action",
+			content: "redaction: {rules: [{label: JobName, action: encrypt}]}",
+			err:     `redaction.rules[0]: unknown action "encrypt"`,
+		},
+		{
+			name:    "mask without regex",
+			content: "redaction: {rules: [{label: JobName, action: mask}]}",
+			err:     "redaction.rules[0]: missing regex",
+		},
+		{
+			name:    "invalid regex",
+			content: "redaction: {rules: [{label: JobName, action: mask, regex: '('}]}",
+			err:     "redaction.rules[0]: invalid regex",
+		},
+		{
+			name:    "regex without mask",
+			content: "redaction: {rules: [{label: JobName, action: drop, regex: x}]}",
+			err:     "redaction.rules[0]: regex and replacement are only valid with action mask",
+		},
+		{
+			name:    "negative label_max_length",
+			content: "redaction: {label_max_length: -1}",
+			err:     "redaction: invalid label_max_length -1",
+		},
+	} {
+		_, err := Load([]byte(c.content))
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+		case c.err != "" && err == nil:
+			t.Errorf("%s: expected error %q", c.name, c.err)
+		case c.err != "" && !strings.Contains(err.Error(), c.err):
+			t.Errorf("%s: got error %q, want %q", c.name, err, c.err)
+		}
+	}
+}
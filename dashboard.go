@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/pbspro_exporter/collector"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/version"
+)
+
+// dashboardTopUsers is the number of users listed by running cores.
+const dashboardTopUsers = 10
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"bytes":   formatBytes,
+	"percent": func(r float64) string { return fmt.Sprintf("%.1f%%", 100*r) },
+	"time":    func(t time.Time) string { return t.Format("2006-01-02T15:04:05Z07:00") },
+}).Parse(`<html>
+<head><title>PBSPro Exporter</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #999; padding: 2px 8px; text-align: left; }
+td.num { text-align: right; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>PBSPro Exporter</h1>
+<p><a href="{{.MetricsPath}}">Metrics</a> | <a href="/status">Status</a> | <a href="/api/v1/server">API</a></p>
+{{range .Clusters}}
+<h2>{{.Name}} ({{.Address}})</h2>
+{{if .Err}}<p class="error">Couldn't get the state of PBS: {{.Err}}</p>
+{{else}}<p>State as of {{time .Time}}</p>
+<h3>Utilization</h3>
+<table>
+<tr><th>Resource</th><th>Assigned</th><th>Available</th><th>Utilization</th></tr>
+<tr><td>CPUs</td><td class="num">{{.AssignedNcpus}}</td><td class="num">{{.AvailableNcpus}}</td><td><progress max="1" value="{{.NcpusRatio}}"></progress> {{percent .NcpusRatio}}</td></tr>
+<tr><td>Memory</td><td class="num">{{bytes .AssignedMem}}</td><td class="num">{{bytes .AvailableMem}}</td><td><progress max="1" value="{{.MemRatio}}"></progress> {{percent .MemRatio}}</td></tr>
+</table>
+<h3>Nodes by state</h3>
+<table>
+<tr><th>State</th><th>Nodes</th><th>CPUs</th></tr>
+{{range .NodeStates}}<tr><td>{{.State}}</td><td class="num">{{.Nodes}}</td><td class="num">{{.Ncpus}}</td></tr>
+{{end}}</table>
+<h3>Queues</h3>
+<table>
+<tr><th>Queue</th><th>Type</th><th>Enabled</th><th>Started</th><th>Queued</th><th>Held</th><th>Running</th><th>Assigned CPUs</th></tr>
+{{range .Queues}}<tr><td>{{.QueueName}}</td><td>{{.QueueType}}</td><td>{{if .Enable}}yes{{else}}no{{end}}</td><td>{{if .Started}}yes{{else}}no{{end}}</td><td class="num">{{.StateCountQueued}}</td><td class="num">{{.StateCountHeld}}</td><td class="num">{{.StateCountRunning}}</td><td class="num">{{.ResourcesAssignedNcpus}}</td></tr>
+{{end}}</table>
+<h3>Top users by running CPUs</h3>
+<table>
+<tr><th>User</th><th>Running jobs</th><th>CPUs</th></tr>
+{{range .TopUsers}}<tr><td>{{if .User}}{{.User}}{{else}}<i>redacted</i>{{end}}</td><td class="num">{{.Jobs}}</td><td class="num">{{.Ncpus}}</td></tr>
+{{else}}<tr><td colspan="3">No running jobs</td></tr>
+{{end}}</table>
+{{end}}{{end}}
+<p>{{.Version}}</p>
+</body>
+</html>
+`))
+
+// dashboardCluster is the summary of a PBS server shown on the dashboard.
+type dashboardCluster struct {
+	collector.PBSServer
+	Time time.Time
+	Err  error
+
+	AssignedNcpus, AvailableNcpus int64
+	AssignedMem, AvailableMem     int64
+	NcpusRatio, MemRatio          float64
+
+	NodeStates []nodeStateSummary
+	Queues     []qstat.QstatQueueInfo
+	TopUsers   []userSummary
+}
+
+type nodeStateSummary struct {
+	State string
+	Nodes int
+	Ncpus int64
+}
+
+type userSummary struct {
+	User  string
+	Jobs  int
+	Ncpus int64
+}
+
+// dashboardHandler serves the dashboard at /, a summary of the cached state
+// of the PBS servers for people without access to Grafana.
+type dashboardHandler struct {
+	handler     *handler
+	metricsPath string
+	// state returns the state of a server, collector.CurrentState unless
+	// replaced in tests.
+	state func(server collector.PBSServer) (*collector.State, error)
+}
+
+func newDashboardHandler(h *handler, metricsPath string, maxAge time.Duration) *dashboardHandler {
+	return &dashboardHandler{
+		handler:     h,
+		metricsPath: metricsPath,
+		state: func(server collector.PBSServer) (*collector.State, error) {
+			return collector.CurrentState(server, maxAge)
+		},
+	}
+}
+
+func (d *dashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	servers := d.handler.currentServers()
+	states, errs := fetchStates(servers, d.state)
+	var clusters []dashboardCluster
+	for i, server := range servers {
+		if errs[i] != nil {
+			clusters = append(clusters, dashboardCluster{PBSServer: server, Err: errs[i]})
+			continue
+		}
+		clusters = append(clusters, summarize(states[i]))
+	}
+
+	data := struct {
+		MetricsPath string
+		Clusters    []dashboardCluster
+		Version     string
+	}{
+		MetricsPath: d.metricsPath,
+		Clusters:    clusters,
+		Version:     version.Info(),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		log.Errorln("Error rendering dashboard:", err)
+	}
+}
+
+// summarize returns the dashboard summary of the state of a PBS server.
+// Users are the redacted job owners.
+func summarize(s *collector.State) dashboardCluster {
+	c := dashboardCluster{PBSServer: s.Server, Time: s.Time, Queues: s.Queues}
+
+	byState := make(map[string]*nodeStateSummary)
+	for _, node := range s.Nodes {
+		c.AssignedNcpus += node.ResourcesAssignedNcpus
+		c.AvailableNcpus += node.ResourcesAvailableNcpus
+		c.AssignedMem += node.ResourcesAssignedMem
+		c.AvailableMem += node.ResourcesAvailableMem
+		ns, ok := byState[node.State]
+		if !ok {
+			ns = &nodeStateSummary{State: node.State}
+			byState[node.State] = ns
+		}
+		ns.Nodes++
+		ns.Ncpus += node.ResourcesAvailableNcpus
+	}
+	c.NcpusRatio = ratio(c.AssignedNcpus, c.AvailableNcpus)
+	c.MemRatio = ratio(c.AssignedMem, c.AvailableMem)
+	for _, ns := range byState {
+		c.NodeStates = append(c.NodeStates, *ns)
+	}
+	sort.Slice(c.NodeStates, func(i, j int) bool { return c.NodeStates[i].State < c.NodeStates[j].State })
+
+	// The jobs can't fail without a user filter.
+	byUser, _ := s.UserJobs(collector.JobFilter{States: []string{"R"}})
+	for user, jobs := range byUser {
+		u := userSummary{User: user}
+		for _, job := range jobs {
+			u.Jobs++
+			u.Ncpus += job.ResourceListNcpus
+		}
+		c.TopUsers = append(c.TopUsers, u)
+	}
+	sort.Slice(c.TopUsers, func(i, j int) bool {
+		if c.TopUsers[i].Ncpus != c.TopUsers[j].Ncpus {
+			return c.TopUsers[i].Ncpus > c.TopUsers[j].Ncpus
+		}
+		return c.TopUsers[i].User < c.TopUsers[j].User
+	})
+	if len(c.TopUsers) > dashboardTopUsers {
+		c.TopUsers = c.TopUsers[:dashboardTopUsers]
+	}
+	return c
+}
+
+func ratio(a, b int64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+// formatBytes formats a number of bytes with a binary unit.
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTP"[exp])
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/pbspro_exporter/collector"
+)
+
+func TestSummarize(t *testing.T) {
+	s := collector.NewState(collector.PBSServer{Name: "hpc1"}, time.Now(), nil, nil,
+		[]qstat.QstatNodeInfo{
+			{NodeName: "n1", State: "job-busy", ResourcesAvailableNcpus: 32, ResourcesAssignedNcpus: 32, ResourcesAvailableMem: 64 << 30, ResourcesAssignedMem: 16 << 30},
+			{NodeName: "n2", State: "free", ResourcesAvailableNcpus: 32, ResourcesAssignedNcpus: 16, ResourcesAvailableMem: 64 << 30},
+			{NodeName: "n3", State: "free", ResourcesAvailableNcpus: 64},
+		},
+		[]qstat.QstatJobsInfo{
+			{JobOwner: "alice@login1", JobState: "R", ResourceListNcpus: 16},
+			{JobOwner: "bob@login1", JobState: "R", ResourceListNcpus: 24},
+			{JobOwner: "alice@login2", JobState: "R", ResourceListNcpus: 8},
+			{JobOwner: "carol@login1", JobState: "Q", ResourceListNcpus: 128},
+		})
+
+	c := summarize(s)
+	if c.AssignedNcpus != 48 || c.AvailableNcpus != 128 || c.NcpusRatio != 0.375 || c.MemRatio != 0.125 {
+		t.Errorf("got utilization %d/%d (%g), memory %g", c.AssignedNcpus, c.AvailableNcpus, c.NcpusRatio, c.MemRatio)
+	}
+	if want := []nodeStateSummary{{"free", 2, 96}, {"job-busy", 1, 32}}; !reflect.DeepEqual(c.NodeStates, want) {
+		t.Errorf("got node states %v, want %v", c.NodeStates, want)
+	}
+	// The jobs of a user are grouped regardless of the submit host.
+	if want := []userSummary{{"alice", 2, 24}, {"bob", 1, 24}}; !reflect.DeepEqual(c.TopUsers, want) {
+		t.Errorf("got top users %v, want %v", c.TopUsers, want)
+	}
+
+	// The users are redacted by the JobOwner rule for display.
+	defer collector.SetRedaction(collector.Redaction{})
+	if err := collector.SetRedaction(collector.Redaction{Rules: []collector.RedactionRule{{Label: "JobOwner", Action: collector.RedactHash}}}); err != nil {
+		t.Fatal(err)
+	}
+	c = summarize(s)
+	if len(c.TopUsers) != 2 || c.TopUsers[0].Jobs != 2 || c.TopUsers[0].User == "alice" || c.TopUsers[0].User == "" {
+		t.Errorf("got top users %v, want 2 jobs of a hashed alice", c.TopUsers)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	api := testAPIHandler()
+	d := &dashboardHandler{handler: api.handler, metricsPath: "/metrics", state: api.state}
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`<a href="/metrics">Metrics</a>`,
+		"<h2>hpc1 (10.0.0.1)</h2>",
+		"<td>down,offline</td>",
+		"<td>workq</td>",
+		"<td>alice</td>",
+		"Couldn't get the state of PBS: connection refused",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("dashboard doesn't contain %q:\n%s", want, body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/favicon.ico", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d for an unknown path", w.Code)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for b, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 64 << 30: "64.0 GiB"} {
+		if got := formatBytes(b); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", b, got, want)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gsangwell/pbspro_exporter/collector"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/version"
+)
+
+// OTLP push modes.
+const (
+	pushModeOTLPHTTP = "otlp-http"
+	pushModeOTLPGRPC = "otlp-grpc"
+)
+
+const (
+	otlpHTTPPath = "/v1/metrics"
+	otlpGRPCPath = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	// otlpCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+	otlpCumulative = 2
+)
+
+// otlpRetryableCodes are the gRPC status codes OTLP exporters retry.
+var otlpRetryableCodes = map[int]bool{
+	1:  true, // CANCELLED
+	4:  true, // DEADLINE_EXCEEDED
+	10: true, // ABORTED
+	11: true, // OUT_OF_RANGE
+	14: true, // UNAVAILABLE
+	15: true, // DATA_LOSS
+}
+
+// newOTLPClient returns an HTTP client for the OTLP endpoint. gRPC needs
+// HTTP/2, which is negotiated with TLS for https URLs and used without TLS
+// otherwise.
+func newOTLPClient(mode, endpoint string, timeout time.Duration) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if mode == pushModeOTLPGRPC {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.Protocols = new(http.Protocols)
+		if strings.HasPrefix(endpoint, "https://") {
+			t.Protocols.SetHTTP2(true)
+		} else {
+			t.Protocols.SetUnencryptedHTTP2(true)
+		}
+		client.Transport = t
+	}
+	return client
+}
+
+// pushOTLP exports the metrics of every server as OTLP resource metrics,
+// with the server as resource attributes.
+func (p *pusher) pushOTLP(ctx context.Context, servers []collector.PBSServer) error {
+	now := time.Now()
+	req := &otlpExportRequest{}
+	for _, server := range servers {
+		g, err := p.registry([]collector.PBSServer{server})
+		if err != nil {
+			return err
+		}
+		mfs, err := g.Gather()
+		if err != nil && len(mfs) == 0 {
+			return fmt.Errorf("server %s: %s", server.Name, err)
+		}
+		req.ResourceMetrics = append(req.ResourceMetrics, toOTLPResourceMetrics(server, p.job, mfs, p.start, now))
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	if p.mode == pushModeOTLPGRPC {
+		return p.retry(ctx, func() (bool, error) { return p.exportGRPC(ctx, data) })
+	}
+	return p.retry(ctx, func() (bool, error) { return p.exportHTTP(ctx, data) })
+}
+
+// exportHTTP sends an export request with OTLP/HTTP. The path defaults to
+// /v1/metrics.
+func (p *pusher) exportHTTP(ctx context.Context, data []byte) (bool, error) {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return false, err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpHTTPPath
+	}
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 == 2 {
+		logPartialSuccess(body)
+		return false, nil
+	}
+	err = fmt.Errorf("server returned HTTP status %s", resp.Status)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, err
+	}
+	return false, err
+}
+
+// exportGRPC sends an export request as a unary call of the OTLP/gRPC
+// metrics service.
+func (p *pusher) exportGRPC(ctx context.Context, data []byte) (bool, error) {
+	// A gRPC message is prefixed by a compressed flag and its length.
+	body := make([]byte, 5+len(data))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(data)))
+	copy(body[5:], data)
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(p.url, "/")+otlpGRPCPath, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	msg, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return true, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode == http.StatusServiceUnavailable, fmt.Errorf("server returned HTTP status %s", resp.Status)
+	}
+
+	// The status is sent in the trailers, or in the headers if there is
+	// no response message.
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return false, fmt.Errorf("invalid gRPC status %q", status)
+	}
+	if code != 0 {
+		if m, err := url.PathUnescape(message); err == nil {
+			message = m
+		}
+		return otlpRetryableCodes[code], fmt.Errorf("gRPC status %d: %s", code, message)
+	}
+	if len(msg) >= 5 {
+		logPartialSuccess(msg[5:])
+	}
+	return false, nil
+}
+
+// logPartialSuccess logs the data points an OTLP receiver rejected.
+func logPartialSuccess(data []byte) {
+	resp := &otlpExportResponse{}
+	if err := proto.Unmarshal(data, resp); err != nil || resp.PartialSuccess == nil {
+		return
+	}
+	if ps := resp.PartialSuccess; ps.RejectedDataPoints > 0 || ps.ErrorMessage != "" {
+		log.Warnf("OTLP receiver rejected %d data points: %s", ps.RejectedDataPoints, ps.ErrorMessage)
+	}
+}
+
+// toOTLPResourceMetrics converts the metric families of a server. Gauges
+// and untyped metrics become gauges, counters cumulative monotonic sums
+// starting at start. Other types are left out. The cluster label is a
+// resource attribute rather than a data point attribute.
+func toOTLPResourceMetrics(server collector.PBSServer, job string, mfs []*dto.MetricFamily, start, now time.Time) *otlpResourceMetrics {
+	scope := &otlpScopeMetrics{Scope: &otlpScope{Name: "pbspro_exporter", Version: version.Version}}
+	for _, mf := range mfs {
+		var points []*otlpNumberDataPoint
+		for _, m := range mf.Metric {
+			var v float64
+			switch mf.GetType() {
+			case dto.MetricType_GAUGE:
+				v = m.GetGauge().GetValue()
+			case dto.MetricType_COUNTER:
+				v = m.GetCounter().GetValue()
+			case dto.MetricType_UNTYPED:
+				v = m.GetUntyped().GetValue()
+			default:
+				continue
+			}
+			point := &otlpNumberDataPoint{
+				TimeUnixNano: uint64(now.UnixNano()),
+				AsDouble:     proto.Float64(v),
+			}
+			for _, l := range m.Label {
+				if l.GetName() == "cluster" || l.GetValue() == "" {
+					continue
+				}
+				point.Attributes = append(point.Attributes, otlpAttribute(l.GetName(), l.GetValue()))
+			}
+			if mf.GetType() == dto.MetricType_COUNTER {
+				point.StartTimeUnixNano = uint64(start.UnixNano())
+			}
+			points = append(points, point)
+		}
+		if len(points) == 0 {
+			continue
+		}
+		metric := &otlpMetric{Name: mf.GetName(), Description: mf.GetHelp()}
+		if mf.GetType() == dto.MetricType_COUNTER {
+			metric.Sum = &otlpSum{DataPoints: points, AggregationTemporality: otlpCumulative, IsMonotonic: true}
+		} else {
+			metric.Gauge = &otlpGauge{DataPoints: points}
+		}
+		scope.Metrics = append(scope.Metrics, metric)
+	}
+
+	return &otlpResourceMetrics{
+		Resource: &otlpResource{Attributes: []*otlpKeyValue{
+			otlpAttribute("service.name", job),
+			otlpAttribute("cluster", server.Name),
+			otlpAttribute("server.address", server.Address),
+		}},
+		ScopeMetrics: []*otlpScopeMetrics{scope},
+	}
+}
+
+func otlpAttribute(key, value string) *otlpKeyValue {
+	return &otlpKeyValue{Key: key, Value: &otlpAnyValue{StringValue: value}}
+}
+
+// The messages below are the subset of the OTLP metrics protocol, as
+// defined in opentelemetry-proto, that the exporter sends.
+
+type otlpExportRequest struct {
+	ResourceMetrics []*otlpResourceMetrics `protobuf:"bytes,1,rep,name=resource_metrics"`
+}
+
+func (m *otlpExportRequest) Reset()         { *m = otlpExportRequest{} }
+func (m *otlpExportRequest) String() string { return proto.CompactTextString(m) }
+func (*otlpExportRequest) ProtoMessage()    {}
+
+type otlpExportResponse struct {
+	PartialSuccess *otlpPartialSuccess `protobuf:"bytes,1,opt,name=partial_success"`
+}
+
+func (m *otlpExportResponse) Reset()         { *m = otlpExportResponse{} }
+func (m *otlpExportResponse) String() string { return proto.CompactTextString(m) }
+func (*otlpExportResponse) ProtoMessage()    {}
+
+type otlpPartialSuccess struct {
+	RejectedDataPoints int64  `protobuf:"varint,1,opt,name=rejected_data_points,proto3"`
+	ErrorMessage       string `protobuf:"bytes,2,opt,name=error_message,proto3"`
+}
+
+func (m *otlpPartialSuccess) Reset()         { *m = otlpPartialSuccess{} }
+func (m *otlpPartialSuccess) String() string { return proto.CompactTextString(m) }
+func (*otlpPartialSuccess) ProtoMessage()    {}
+
+type otlpResourceMetrics struct {
+	Resource     *otlpResource       `protobuf:"bytes,1,opt,name=resource"`
+	ScopeMetrics []*otlpScopeMetrics `protobuf:"bytes,2,rep,name=scope_metrics"`
+}
+
+func (m *otlpResourceMetrics) Reset()         { *m = otlpResourceMetrics{} }
+func (m *otlpResourceMetrics) String() string { return proto.CompactTextString(m) }
+func (*otlpResourceMetrics) ProtoMessage()    {}
+
+type otlpResource struct {
+	Attributes []*otlpKeyValue `protobuf:"bytes,1,rep,name=attributes"`
+}
+
+func (m *otlpResource) Reset()         { *m = otlpResource{} }
+func (m *otlpResource) String() string { return proto.CompactTextString(m) }
+func (*otlpResource) ProtoMessage()    {}
+
+type otlpKeyValue struct {
+	Key   string        `protobuf:"bytes,1,opt,name=key,proto3"`
+	Value *otlpAnyValue `protobuf:"bytes,2,opt,name=value"`
+}
+
+func (m *otlpKeyValue) Reset()         { *m = otlpKeyValue{} }
+func (m *otlpKeyValue) String() string { return proto.CompactTextString(m) }
+func (*otlpKeyValue) ProtoMessage()    {}
+
+// otlpAnyValue only has the string_value of the value oneof.
+type otlpAnyValue struct {
+	StringValue string `protobuf:"bytes,1,opt,name=string_value,proto3"`
+}
+
+func (m *otlpAnyValue) Reset()         { *m = otlpAnyValue{} }
+func (m *otlpAnyValue) String() string { return proto.CompactTextString(m) }
+func (*otlpAnyValue) ProtoMessage()    {}
+
+type otlpScopeMetrics struct {
+	Scope   *otlpScope    `protobuf:"bytes,1,opt,name=scope"`
+	Metrics []*otlpMetric `protobuf:"bytes,2,rep,name=metrics"`
+}
+
+func (m *otlpScopeMetrics) Reset()         { *m = otlpScopeMetrics{} }
+func (m *otlpScopeMetrics) String() string { return proto.CompactTextString(m) }
+func (*otlpScopeMetrics) ProtoMessage()    {}
+
+type otlpScope struct {
+	Name    string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Version string `protobuf:"bytes,2,opt,name=version,proto3"`
+}
+
+func (m *otlpScope) Reset()         { *m = otlpScope{} }
+func (m *otlpScope) String() string { return proto.CompactTextString(m) }
+func (*otlpScope) ProtoMessage()    {}
+
+// otlpMetric has the gauge and sum of the data oneof, of which one is set.
+type otlpMetric struct {
+	Name        string     `protobuf:"bytes,1,opt,name=name,proto3"`
+	Description string     `protobuf:"bytes,2,opt,name=description,proto3"`
+	Unit        string     `protobuf:"bytes,3,opt,name=unit,proto3"`
+	Gauge       *otlpGauge `protobuf:"bytes,5,opt,name=gauge"`
+	Sum         *otlpSum   `protobuf:"bytes,7,opt,name=sum"`
+}
+
+func (m *otlpMetric) Reset()         { *m = otlpMetric{} }
+func (m *otlpMetric) String() string { return proto.CompactTextString(m) }
+func (*otlpMetric) ProtoMessage()    {}
+
+type otlpGauge struct {
+	DataPoints []*otlpNumberDataPoint `protobuf:"bytes,1,rep,name=data_points"`
+}
+
+func (m *otlpGauge) Reset()         { *m = otlpGauge{} }
+func (m *otlpGauge) String() string { return proto.CompactTextString(m) }
+func (*otlpGauge) ProtoMessage()    {}
+
+type otlpSum struct {
+	DataPoints             []*otlpNumberDataPoint `protobuf:"bytes,1,rep,name=data_points"`
+	AggregationTemporality int32                  `protobuf:"varint,2,opt,name=aggregation_temporality,proto3"`
+	IsMonotonic            bool                   `protobuf:"varint,3,opt,name=is_monotonic,proto3"`
+}
+
+func (m *otlpSum) Reset()         { *m = otlpSum{} }
+func (m *otlpSum) String() string { return proto.CompactTextString(m) }
+func (*otlpSum) ProtoMessage()    {}
+
+// otlpNumberDataPoint has the as_double of the value oneof. It is a pointer
+// so that 0 is sent.
+type otlpNumberDataPoint struct {
+	StartTimeUnixNano uint64          `protobuf:"fixed64,2,opt,name=start_time_unix_nano,proto3"`
+	TimeUnixNano      uint64          `protobuf:"fixed64,3,opt,name=time_unix_nano,proto3"`
+	AsDouble          *float64        `protobuf:"fixed64,4,opt,name=as_double"`
+	Attributes        []*otlpKeyValue `protobuf:"bytes,7,rep,name=attributes"`
+}
+
+func (m *otlpNumberDataPoint) Reset()         { *m = otlpNumberDataPoint{} }
+func (m *otlpNumberDataPoint) String() string { return proto.CompactTextString(m) }
+func (*otlpNumberDataPoint) ProtoMessage()    {}
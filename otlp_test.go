@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// otlpReceiver is an OTLP receiver stub accepting OTLP/HTTP and, over
+// unencrypted HTTP/2, OTLP/gRPC export requests.
+type otlpReceiver struct {
+	*httptest.Server
+	requests []*otlpExportRequest
+	paths    []string
+	// grpcStatus is returned for the first calls, as long as it is not
+	// empty.
+	grpcStatus []string
+}
+
+func newOTLPReceiver(t *testing.T) *otlpReceiver {
+	r := &otlpReceiver{}
+	r.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.paths = append(r.paths, req.URL.Path)
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		grpc := req.Header.Get("Content-Type") == "application/grpc"
+		if grpc {
+			if req.ProtoMajor != 2 {
+				t.Errorf("gRPC call over HTTP/%d.%d", req.ProtoMajor, req.ProtoMinor)
+			}
+			if len(data) < 5 || int(binary.BigEndian.Uint32(data[1:5])) != len(data)-5 {
+				t.Fatalf("invalid gRPC message framing")
+			}
+			data = data[5:]
+			if len(r.grpcStatus) > 0 {
+				w.Header().Set("Grpc-Status", r.grpcStatus[0])
+				w.Header().Set("Grpc-Message", "try%20again")
+				r.grpcStatus = r.grpcStatus[1:]
+				return
+			}
+		}
+		export := &otlpExportRequest{}
+		if err := proto.Unmarshal(data, export); err != nil {
+			t.Fatal(err)
+		}
+		r.requests = append(r.requests, export)
+
+		resp, _ := proto.Marshal(&otlpExportResponse{})
+		if !grpc {
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			w.Write(resp)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write(append(make([]byte, 5), resp...))
+		w.Header().Set("Grpc-Status", "0")
+	}))
+	r.Config.Protocols = new(http.Protocols)
+	r.Config.Protocols.SetHTTP1(true)
+	r.Config.Protocols.SetUnencryptedHTTP2(true)
+	r.Start()
+	return r
+}
+
+// otlpSeries flattens export requests to lines of resource attributes,
+// metric name and type, data point attributes and value.
+func otlpSeries(t *testing.T, reqs []*otlpExportRequest) string {
+	var series []string
+	for _, req := range reqs {
+		for _, rm := range req.ResourceMetrics {
+			var resource []string
+			for _, a := range rm.Resource.Attributes {
+				resource = append(resource, a.Key+"="+a.Value.StringValue)
+			}
+			for _, sm := range rm.ScopeMetrics {
+				if sm.Scope.Name != "pbspro_exporter" {
+					t.Errorf("got scope %q", sm.Scope.Name)
+				}
+				for _, m := range sm.Metrics {
+					typ, points := "gauge", []*otlpNumberDataPoint(nil)
+					switch {
+					case m.Gauge != nil:
+						points = m.Gauge.DataPoints
+					case m.Sum != nil:
+						typ = fmt.Sprintf("sum(temporality=%d,monotonic=%t)", m.Sum.AggregationTemporality, m.Sum.IsMonotonic)
+						points = m.Sum.DataPoints
+					}
+					for _, p := range points {
+						if p.TimeUnixNano == 0 || (m.Sum != nil) != (p.StartTimeUnixNano != 0) {
+							t.Errorf("%s: unexpected timestamps %d, %d", m.Name, p.StartTimeUnixNano, p.TimeUnixNano)
+						}
+						var attrs []string
+						for _, a := range p.Attributes {
+							attrs = append(attrs, a.Key+"="+a.Value.StringValue)
+						}
+						if p.AsDouble == nil {
+							t.Fatalf("%s: no value", m.Name)
+						}
+						series = append(series, fmt.Sprintf("%s %s %s {%s} %g", strings.Join(resource, ","), m.Name, typ, strings.Join(attrs, ","), *p.AsDouble))
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(series)
+	return strings.Join(series, "\n")
+}
+
+const wantOTLPSeries = `service.name=pbspro,cluster=hpc1,server.address= requests_total sum(temporality=2,monotonic=true) {} 3
+service.name=pbspro,cluster=hpc1,server.address= up gauge {} 1
+service.name=pbspro,cluster=hpc2,server.address= requests_total sum(temporality=2,monotonic=true) {} 3
+service.name=pbspro,cluster=hpc2,server.address= up gauge {} 1`
+
+func TestOTLPHTTP(t *testing.T) {
+	r := newOTLPReceiver(t)
+	defer r.Close()
+
+	if err := testPusher(r.URL, pushModeOTLPHTTP).push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.paths) != 1 || r.paths[0] != otlpHTTPPath {
+		t.Errorf("got requests to %v, want one to %s", r.paths, otlpHTTPPath)
+	}
+	if got := otlpSeries(t, r.requests); got != wantOTLPSeries {
+		t.Errorf("got series\n%s\nwant\n%s", got, wantOTLPSeries)
+	}
+}
+
+func TestOTLPGRPC(t *testing.T) {
+	r := newOTLPReceiver(t)
+	defer r.Close()
+	r.grpcStatus = []string{"14"}
+
+	if err := testPusher(r.URL, pushModeOTLPGRPC).push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.paths) != 2 || r.paths[1] != otlpGRPCPath {
+		t.Errorf("got calls to %v, want a retried call to %s", r.paths, otlpGRPCPath)
+	}
+	if got := otlpSeries(t, r.requests); got != wantOTLPSeries {
+		t.Errorf("got series\n%s\nwant\n%s", got, wantOTLPSeries)
+	}
+}
+
+func TestOTLPGRPCError(t *testing.T) {
+	r := newOTLPReceiver(t)
+	defer r.Close()
+	// INVALID_ARGUMENT is not retried.
+	r.grpcStatus = []string{"3", "3"}
+
+	err := testPusher(r.URL, pushModeOTLPGRPC).push(context.Background())
+	if err == nil || err.Error() != "gRPC status 3: try again" {
+		t.Errorf("got error %v", err)
+	}
+	if len(r.paths) != 1 {
+		t.Errorf("permanent error retried, got %d calls", len(r.paths))
+	}
+}
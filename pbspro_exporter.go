@@ -14,16 +14,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
-	"sort"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/log"
 	"github.com/prometheus/common/version"
 	"github.com/gsangwell/pbspro_exporter/collector"
+	"github.com/gsangwell/pbspro_exporter/web"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -31,7 +37,12 @@ import (
 // created on the fly, if filtering is requested. Create instances with
 // newHandler.
 type handler struct {
+	// mtx guards unfilteredHandler and servers, which are replaced when
+	// the configuration is reloaded. Scrapes in flight keep using the
+	// handler they started with.
+	mtx               sync.RWMutex
 	unfilteredHandler http.Handler
+	servers           []collector.PBSServer
 	// exporterMetricsRegistry is a separate registry for the metrics about
 	// the exporter itself.
 	exporterMetricsRegistry *prometheus.Registry
@@ -39,7 +50,7 @@ type handler struct {
 	maxRequests             int
 }
 
-func newHandler(includeExporterMetrics bool, maxRequests int) *handler {
+func newHandler(includeExporterMetrics bool, maxRequests int, servers []collector.PBSServer) *handler {
 	h := &handler{
 		exporterMetricsRegistry: prometheus.NewRegistry(),
 		includeExporterMetrics:  includeExporterMetrics,
@@ -51,26 +62,68 @@ func newHandler(includeExporterMetrics bool, maxRequests int) *handler {
 			prometheus.NewGoCollector(),
 		)
 	}
-	if innerHandler, err := h.innerHandler(); err != nil {
+	if err := collector.RegisterRequestMetrics(h.exporterMetricsRegistry); err != nil {
+		log.Fatalf("Couldn't register PBS request metrics: %s", err)
+	}
+	if err := h.setServers(servers); err != nil {
 		log.Fatalf("Couldn't create metrics handler: %s", err)
-	} else {
-		h.unfilteredHandler = innerHandler
 	}
 	return h
 }
 
+// setServers replaces the PBS servers scraped by the handler.
+func (h *handler) setServers(servers []collector.PBSServer) error {
+	innerHandler, err := h.innerHandler(servers, collector.NewPBSCollector)
+	if err != nil {
+		return err
+	}
+	h.swap(innerHandler, servers, func() {})
+	return nil
+}
+
+// swap replaces the unfiltered handler and the servers it scrapes, and calls
+// apply while scrapes can't pick up either, so that changes made by apply
+// take effect together with the new handler.
+func (h *handler) swap(innerHandler http.Handler, servers []collector.PBSServer, apply func()) {
+	h.mtx.Lock()
+	apply()
+	h.unfilteredHandler = innerHandler
+	h.servers = servers
+	h.mtx.Unlock()
+	collector.PruneStatus(servers)
+
+	for _, server := range servers {
+		log.Infof("Scraping PBS server %s at %s", server.Name, server.Address)
+	}
+	log.Infof("Enabled collectors:")
+	for _, n := range collector.EnabledCollectors() {
+		log.Infof(" - %s", n)
+	}
+}
+
+// currentServers returns the PBS servers scraped by the handler.
+func (h *handler) currentServers() []collector.PBSServer {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	return h.servers
+}
+
 // ServeHTTP implements http.Handler.
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	filters := r.URL.Query()["collect[]"]
 	log.Debugln("collect query:", filters)
 
+	h.mtx.RLock()
+	unfilteredHandler, servers := h.unfilteredHandler, h.servers
+	h.mtx.RUnlock()
+
 	if len(filters) == 0 {
 		// No filters, use the prepared unfiltered handler.
-		h.unfilteredHandler.ServeHTTP(w, r)
+		unfilteredHandler.ServeHTTP(w, r)
 		return
 	}
 	// To serve filtered metrics, we create a filtering handler on the fly.
-	filteredHandler, err := h.innerHandler(filters...)
+	filteredHandler, err := h.innerHandler(servers, collector.NewPBSCollector, filters...)
 	if err != nil {
 		log.Warnln("Couldn't create filtered metrics handler:", err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -82,33 +135,12 @@ func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // innerHandler is used to create buth the one unfiltered http.Handler to be
 // wrapped by the outer handler and also the filtered handlers created on the
-// fly. The former is accomplished by calling innerHandler without any arguments
-// (in which case it will log all the collectors enabled via command-line
-// flags).
-func (h *handler) innerHandler(filters ...string) (http.Handler, error) {
-	nc, err := collector.NewPBSCollector(filters...)
+// fly. The former is accomplished by calling innerHandler without any
+// filters.
+func (h *handler) innerHandler(servers []collector.PBSServer, newCollector collectorFactory, filters ...string) (http.Handler, error) {
+	r, err := newRegistry(servers, nil, newCollector, filters...)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't create collector: %s", err)
-	}
-
-	// Only log the creation of an unfiltered handler, which should happen
-	// only once upon startup.
-	if len(filters) == 0 {
-		log.Infof("Enabled collectors:")
-		collectors := []string{}
-		for n := range nc.Collectors {
-			collectors = append(collectors, n)
-		}
-		sort.Strings(collectors)
-		for _, n := range collectors {
-			log.Infof(" - %s", n)
-		}
-	}
-
-	r := prometheus.NewRegistry()
-	r.MustRegister(version.NewCollector("pbspro_exporter"))
-	if err := r.Register(nc); err != nil {
-		return nil, fmt.Errorf("couldn't register pbspro collector: %s", err)
+		return nil, err
 	}
 	handler := promhttp.HandlerFor(
 		prometheus.Gatherers{h.exporterMetricsRegistry, r},
@@ -128,6 +160,38 @@ func (h *handler) innerHandler(filters ...string) (http.Handler, error) {
 	return handler, nil
 }
 
+// collectorFactory creates the PBSCollector of a server, e.g.
+// collector.NewPBSCollector or collector.NewProbeCollector for probe
+// targets.
+type collectorFactory func(server collector.PBSServer, logger log.Logger, filters ...string) (*collector.PBSCollector, error)
+
+// newRegistry returns a registry with a PBSCollector for every server,
+// restricted to the collectors in filters if any are given.
+//
+// Every PBS server gets its own PBSCollector, registered with a cluster
+// label and the given labels. The registry gathers them concurrently, and a
+// failing server only affects its own collector_success metrics.
+func newRegistry(servers []collector.PBSServer, labels map[string]string, newCollector collectorFactory, filters ...string) (*prometheus.Registry, error) {
+	r := prometheus.NewRegistry()
+	r.MustRegister(version.NewCollector("pbspro_exporter"))
+
+	for _, server := range servers {
+		nc, err := newCollector(server, log.Base(), filters...)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't create collector: %s", err)
+		}
+
+		l := prometheus.Labels{"cluster": server.Name}
+		for k, v := range labels {
+			l[k] = v
+		}
+		if err := prometheus.WrapRegistererWith(l, r).Register(nc); err != nil {
+			return nil, fmt.Errorf("couldn't register pbspro collector for %s: %s", server.Name, err)
+		}
+	}
+	return r, nil
+}
+
 func main() {
 	var (
 		listenAddress = kingpin.Flag(
@@ -146,29 +210,211 @@ func main() {
 			"web.max-requests",
 			"Maximum number of parallel scrape requests. Use 0 to disable.",
 		).Default("40").Int()
+		configFile = kingpin.Flag(
+			"config.file",
+			"Path to the configuration file. Reloaded on SIGHUP or POST /-/reload.",
+		).Default("").String()
+		webConfig = kingpin.Flag(
+			"web.config.file",
+			"Path to a web configuration file enabling TLS and basic authentication, in the exporter-toolkit format.",
+		).Default("").String()
+		readyMaxAge = kingpin.Flag(
+			"web.ready-max-age",
+			"/-/ready fails unless every PBS server was contacted successfully within this duration.",
+		).Default("1m").Duration()
+		stateMaxAge = kingpin.Flag(
+			"web.state-max-age",
+			"How long the PBS state served by the dashboard, /sd and the /api/v1/ endpoints is cached.",
+		).Default("30s").Duration()
+		shutdownTimeout = kingpin.Flag(
+			"web.shutdown-timeout",
+			"How long to wait for scrapes in flight on SIGTERM or SIGINT.",
+		).Default("30s").Duration()
+		pushURL = kingpin.Flag(
+			"push.url",
+			"Push the metrics to this Pushgateway, remote-write or OTLP receiver URL, in addition to serving them.",
+		).Default("").String()
+		pushMode = kingpin.Flag(
+			"push.mode",
+			"Where --push.url points to, pushgateway, remote-write, otlp-http or otlp-grpc.",
+		).Default(pushModePushgateway).Enum(pushModePushgateway, pushModeRemoteWrite, pushModeOTLPHTTP, pushModeOTLPGRPC)
+		pushInterval = kingpin.Flag(
+			"push.interval",
+			"How often to push the metrics.",
+		).Default("1m").Duration()
+		pushJob = kingpin.Flag(
+			"push.job",
+			"Job label of the pushed metrics.",
+		).Default("pbspro_exporter").String()
+		pushTimeout = kingpin.Flag(
+			"push.timeout",
+			"Timeout of a push request.",
+		).Default("10s").Duration()
+		pushRetries = kingpin.Flag(
+			"push.retries",
+			"How often to retry a failed push, with exponential backoff.",
+		).Default("3").Int()
+		configCheck = kingpin.Flag(
+			"config.check",
+			"Check the configuration and web configuration files and exit.",
+		).Bool()
+
+		collectCmd = kingpin.Command("collect", "Run the enabled collectors once and print the metrics.")
+		output     = collectCmd.Flag(
+			"output",
+			"File to write the metrics to, - for stdout. Files are replaced atomically, e.g. for the node_exporter textfile collector.",
+		).Short('o').Default("-").String()
+		format = collectCmd.Flag(
+			"format",
+			"Format of the metrics, text or openmetrics.",
+		).Default(formatText).Enum(formatText, formatOpenMetrics)
 	)
 
+	kingpin.Command("serve", "Serve the metrics over HTTP.").Default()
 	log.AddFlags(kingpin.CommandLine)
 	kingpin.Version(version.Print("pbspro_exporter"))
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
+
+	if *configCheck {
+		if *configFile == "" && *webConfig == "" {
+			fmt.Fprintln(os.Stderr, "No configuration file given with --config.file or --web.config.file")
+			os.Exit(1)
+		}
+		cfg, err := loadConfig(*configFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Configuration is invalid:", err)
+			os.Exit(1)
+		}
+		flagRedaction, err := collector.FlagRedaction()
+		if err == nil {
+			err = collector.SetRedaction(redactionFromConfig(cfg, flagRedaction))
+		}
+		if err == nil {
+			_, err = moduleSettings(cfg, flagRedaction)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Configuration is invalid:", err)
+			os.Exit(1)
+		}
+		if err := web.Validate(*webConfig); err != nil {
+			fmt.Fprintln(os.Stderr, "Web configuration is invalid:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Configuration OK")
+		os.Exit(0)
+	}
+
+	flagServers, err := collector.Servers()
+	if err != nil {
+		log.Fatalf("Couldn't parse PBS servers: %s", err)
+	}
+	flagRedaction, err := collector.FlagRedaction()
+	if err != nil {
+		log.Fatalf("Couldn't parse redaction rules: %s", err)
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("Couldn't load config file: %s", err)
+	}
+	if err := collector.SetCollectorOverrides(cfg.Collectors); err != nil {
+		log.Fatalf("Couldn't apply config file: %s", err)
+	}
+	if err := collector.SetRedaction(redactionFromConfig(cfg, flagRedaction)); err != nil {
+		log.Fatalf("Couldn't apply config file: %s", err)
+	}
+	modules, err := moduleSettings(cfg, flagRedaction)
+	if err != nil {
+		log.Fatalf("Couldn't apply config file: %s", err)
+	}
+
+	if command == collectCmd.FullCommand() {
+		if err := runCollect(serversFromConfig(cfg, flagServers), *output, *format); err != nil {
+			log.Errorln(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 
 	log.Infoln("Starting pbspro_exporter", version.Info())
 	log.Infoln("Build context", version.BuildContext())
 
-	http.Handle(*metricsPath, newHandler(!*disableExporterMetrics, *maxRequests))
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`<html>
-			<head><title>PBSPro Exporter</title></head>
-			<body>
-			<h1>PBSPro Exporter</h1>
-			<p><a href="` + *metricsPath + `">Metrics</a></p>
-			</body>
-			</html>`))
-	})
+	h := newHandler(!*disableExporterMetrics, *maxRequests, serversFromConfig(cfg, flagServers))
+	p := &probeHandler{config: cfg, modules: modules}
+	reloader := newConfigReloader(*configFile, flagServers, flagRedaction, h, p)
+
+	// ctx is cancelled on shutdown and stops the background goroutines.
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-hup:
+				if err := reloader.reload(); err != nil {
+					log.Errorln("Error reloading config:", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if *pushURL != "" {
+		log.Infof("Pushing metrics to %s every %s", *pushURL, *pushInterval)
+		go newPusher(*pushURL, *pushMode, *pushJob, *pushInterval, *pushTimeout, *pushRetries, h.currentServers).run(ctx)
+	}
+
+	http.Handle(*metricsPath, h)
+	http.Handle("/probe", p)
+	http.Handle("/-/reload", reloader)
+	http.HandleFunc("/-/healthy", healthyHandler)
+	http.Handle("/-/ready", &readyHandler{handler: h, maxAge: *readyMaxAge})
+	http.Handle("/status", &statusHandler{handler: h, maxAge: *readyMaxAge})
+	http.Handle(apiPrefix, newAPIHandler(h, *stateMaxAge))
+	http.Handle("/sd", newSDHandler(h, *stateMaxAge))
+	http.Handle("/", newDashboardHandler(h, *metricsPath, *stateMaxAge))
 
 	log.Infoln("Listening on", *listenAddress)
-	if err := http.ListenAndServe(*listenAddress, nil); err != nil {
+	server := &http.Server{Addr: *listenAddress}
+	if err := serve(server, *webConfig, *shutdownTimeout, stop); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// serve runs server until SIGTERM or SIGINT, then stops the background
+// goroutines and shuts the server down. Scrapes in flight get until timeout
+// to finish; they disconnect from PBS when they return.
+func serve(server *http.Server, webConfig string, timeout time.Duration, stop func()) error {
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(term)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- web.ListenAndServe(server, webConfig)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case sig := <-term:
+		log.Infof("Received %s, shutting down", sig)
+	}
+	stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warnf("Shutdown deadline exceeded with %d collector runs in flight: %s", collector.InFlight(), err)
+		return nil
+	}
+	if err := <-errc; err != http.ErrServerClosed {
+		return err
+	}
+	log.Infoln("Shutdown complete")
+	return nil
+}
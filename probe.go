@@ -0,0 +1,93 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gsangwell/pbspro_exporter/collector"
+	"github.com/gsangwell/pbspro_exporter/config"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+)
+
+// defaultModule is used when /probe is called without a module parameter.
+// If the configuration does not define it, all enabled collectors are used.
+const defaultModule = "default"
+
+// probeHandler serves /probe?target=<pbs-server>&module=<name> in the style
+// of the blackbox exporter. Every request scrapes the target with a
+// PBSCollector created on the fly, so service discovery can drive which PBS
+// servers are scraped.
+type probeHandler struct {
+	mtx    sync.RWMutex
+	config *config.Config
+	// modules are the collector settings of the modules of config.
+	modules map[string]*collector.Settings
+}
+
+// setConfig replaces the configuration and the module settings used for new
+// probes.
+func (p *probeHandler) setConfig(cfg *config.Config, modules map[string]*collector.Settings) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.config = cfg
+	p.modules = modules
+}
+
+// ServeHTTP implements http.Handler.
+func (p *probeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	target := params.Get("target")
+	if target == "" {
+		http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	moduleName := params.Get("module")
+	if moduleName == "" {
+		moduleName = defaultModule
+	}
+	p.mtx.RLock()
+	module, ok := p.config.Modules[moduleName]
+	settings := p.modules[moduleName]
+	p.mtx.RUnlock()
+	if !ok && moduleName != defaultModule {
+		http.Error(w, fmt.Sprintf("Unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+	log.Debugf("probe target %s with module %s", target, moduleName)
+
+	// Without a module, the probe uses the enabled collectors and the
+	// redaction of the exporter.
+	newCollector := collector.NewProbeCollector
+	if settings != nil {
+		newCollector = settings.NewProbeCollector
+	}
+	servers := []collector.PBSServer{{Name: target, Address: target}}
+	r2, err := newRegistry(servers, module.Labels, newCollector)
+	if err != nil {
+		log.Warnln("Couldn't create probe registry:", err)
+		http.Error(w, fmt.Sprintf("Couldn't create probe registry: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	promhttp.HandlerFor(r2, promhttp.HandlerOpts{
+		ErrorLog:      log.NewErrorLogger(),
+		ErrorHandling: promhttp.ContinueOnError,
+	}).ServeHTTP(w, r)
+}
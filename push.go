@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/gsangwell/pbspro_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+// Push modes.
+const (
+	pushModePushgateway = "pushgateway"
+	pushModeRemoteWrite = "remote-write"
+)
+
+// pusher periodically gathers the metrics of the PBS servers and pushes
+// them to a Pushgateway, a remote-write endpoint or an OTLP receiver.
+type pusher struct {
+	url      string
+	mode     string
+	job      string
+	interval time.Duration
+	client   *http.Client
+	// servers returns the PBS servers to push the metrics of.
+	servers func() []collector.PBSServer
+	// registry returns the registry of the servers, newRegistry unless
+	// replaced in tests.
+	registry func(servers []collector.PBSServer) (prometheus.Gatherer, error)
+	// retries is the number of retries of a failed push, which wait
+	// minBackoff, doubling up to maxBackoff, in between.
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	// start is the start time of the cumulative sums sent over OTLP.
+	start time.Time
+}
+
+func newPusher(url, mode, job string, interval, timeout time.Duration, retries int, servers func() []collector.PBSServer) *pusher {
+	return &pusher{
+		url:      url,
+		mode:     mode,
+		job:      job,
+		interval: interval,
+		client:   newOTLPClient(mode, url, timeout),
+		servers:  servers,
+		registry: func(servers []collector.PBSServer) (prometheus.Gatherer, error) {
+			return newRegistry(servers, nil, collector.NewPBSCollector)
+		},
+		retries:    retries,
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+		start:      time.Now(),
+	}
+}
+
+// run pushes the metrics every interval until ctx is cancelled.
+func (p *pusher) run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if err := p.push(ctx); err != nil {
+			log.Errorf("Couldn't push metrics to %s: %s", p.url, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// push pushes the metrics once. A Pushgateway gets a group per PBS server,
+// so a failing server does not replace the metrics of the others. A
+// remote-write endpoint and an OTLP receiver get all servers in one request.
+func (p *pusher) push(ctx context.Context) error {
+	servers := p.servers()
+	switch p.mode {
+	case pushModeOTLPHTTP, pushModeOTLPGRPC:
+		return p.pushOTLP(ctx, servers)
+	case pushModeRemoteWrite:
+		g, err := p.registry(servers)
+		if err != nil {
+			return err
+		}
+		return p.remoteWrite(ctx, g)
+	}
+
+	var firstErr error
+	for _, server := range servers {
+		g, err := p.registry([]collector.PBSServer{server})
+		if err == nil {
+			// The push package only reports the status in its error
+			// message, so the transport records it.
+			rec := &statusRecorder{transport: p.client.Transport}
+			client := *p.client
+			client.Transport = rec
+			pusher := push.New(p.url, p.job).Gatherer(g).Grouping("instance", server.Name).Client(&client)
+			err = p.retry(ctx, func() (bool, error) {
+				rec.sent, rec.code = false, 0
+				err := pusher.Push()
+				// Errors before the request, e.g. conflicting labels,
+				// fail the same way on every retry.
+				return rec.sent && (rec.code == 0 || retryableStatus(rec.code)), err
+			})
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("server %s: %s", server.Name, err)
+		}
+	}
+	return firstErr
+}
+
+// statusRecorder is an http.RoundTripper recording whether a request was
+// sent and the status code of its response, 0 if there was none.
+type statusRecorder struct {
+	transport http.RoundTripper
+	sent      bool
+	code      int
+}
+
+func (s *statusRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := s.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	s.sent = true
+	resp, err := transport.RoundTrip(req)
+	if err == nil {
+		s.code = resp.StatusCode
+	}
+	return resp, err
+}
+
+// retryableStatus reports whether a push that failed with the HTTP status
+// code may succeed when retried. Client errors other than rate limiting
+// fail the same way on every retry.
+func retryableStatus(code int) bool {
+	return code/100 == 5 || code == http.StatusTooManyRequests
+}
+
+// retry calls f until it succeeds, returns a permanent error or the
+// retries are used up, backing off exponentially in between.
+func (p *pusher) retry(ctx context.Context, f func() (retryable bool, err error)) error {
+	backoff := p.minBackoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := f()
+		if err == nil || !retryable || attempt >= p.retries {
+			return err
+		}
+		log.Debugf("Push failed, retrying in %s: %s", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+		if backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+	}
+}
+
+// remoteWrite sends the gathered metrics to a Prometheus remote-write
+// endpoint, as a snappy-compressed protobuf WriteRequest.
+func (p *pusher) remoteWrite(ctx context.Context, g prometheus.Gatherer) error {
+	mfs, err := g.Gather()
+	if err != nil && len(mfs) == 0 {
+		return err
+	}
+	data, err := proto.Marshal(toWriteRequest(mfs, p.job, time.Now()))
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, data)
+
+	return p.retry(ctx, func() (bool, error) {
+		req, err := http.NewRequest("POST", p.url, bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+		resp, err := p.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return true, err
+		}
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		if resp.StatusCode/100 == 2 {
+			return false, nil
+		}
+		err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+		return retryableStatus(resp.StatusCode), err
+	})
+}
+
+// toWriteRequest converts metric families to remote-write time series with
+// a job label and the given timestamp.
+func toWriteRequest(mfs []*dto.MetricFamily, job string, ts time.Time) *writeRequest {
+	req := &writeRequest{}
+	ms := ts.UnixNano() / int64(time.Millisecond)
+	add := func(name string, m *dto.Metric, v float64, extraName, extraValue string) {
+		labels := []*prompbLabel{{Name: "__name__", Value: name}, {Name: "job", Value: job}}
+		for _, l := range m.Label {
+			labels = append(labels, &prompbLabel{Name: l.GetName(), Value: l.GetValue()})
+		}
+		if extraName != "" {
+			labels = append(labels, &prompbLabel{Name: extraName, Value: extraValue})
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+		req.Timeseries = append(req.Timeseries, &timeSeries{
+			Labels:  labels,
+			Samples: []*prompbSample{{Value: v, Timestamp: ms}},
+		})
+	}
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, m := range mf.Metric {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m, m.GetCounter().GetValue(), "", "")
+			case dto.MetricType_GAUGE:
+				add(name, m, m.GetGauge().GetValue(), "", "")
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.Quantile {
+					add(name, m, q.GetValue(), "quantile", fmt.Sprint(q.GetQuantile()))
+				}
+				add(name+"_sum", m, s.GetSampleSum(), "", "")
+				add(name+"_count", m, float64(s.GetSampleCount()), "", "")
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.Bucket {
+					if !math.IsInf(b.GetUpperBound(), +1) {
+						add(name+"_bucket", m, float64(b.GetCumulativeCount()), "le", fmt.Sprint(b.GetUpperBound()))
+					}
+				}
+				add(name+"_bucket", m, float64(h.GetSampleCount()), "le", "+Inf")
+				add(name+"_sum", m, h.GetSampleSum(), "", "")
+				add(name+"_count", m, float64(h.GetSampleCount()), "", "")
+			default:
+				add(name, m, m.GetUntyped().GetValue(), "", "")
+			}
+		}
+	}
+	return req
+}
+
+// writeRequest, timeSeries, prompbLabel and prompbSample are the messages of
+// the remote-write protocol, as defined in prometheus/prompb.
+type writeRequest struct {
+	Timeseries []*timeSeries `protobuf:"bytes,1,rep,name=timeseries"`
+}
+
+func (m *writeRequest) Reset()         { *m = writeRequest{} }
+func (m *writeRequest) String() string { return proto.CompactTextString(m) }
+func (*writeRequest) ProtoMessage()    {}
+
+type timeSeries struct {
+	Labels  []*prompbLabel  `protobuf:"bytes,1,rep,name=labels"`
+	Samples []*prompbSample `protobuf:"bytes,2,rep,name=samples"`
+}
+
+func (m *timeSeries) Reset()         { *m = timeSeries{} }
+func (m *timeSeries) String() string { return proto.CompactTextString(m) }
+func (*timeSeries) ProtoMessage()    {}
+
+type prompbLabel struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *prompbLabel) Reset()         { *m = prompbLabel{} }
+func (m *prompbLabel) String() string { return proto.CompactTextString(m) }
+func (*prompbLabel) ProtoMessage()    {}
+
+type prompbSample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3"`
+}
+
+func (m *prompbSample) Reset()         { *m = prompbSample{} }
+func (m *prompbSample) String() string { return proto.CompactTextString(m) }
+func (*prompbSample) ProtoMessage()    {}
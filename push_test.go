@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/gsangwell/pbspro_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// testPusher returns a pusher of fixed per-server registries holding an up
+// gauge and a request counter.
+func testPusher(url, mode string) *pusher {
+	p := newPusher(url, mode, "pbspro", time.Minute, time.Second, 2, func() []collector.PBSServer {
+		return []collector.PBSServer{{Name: "hpc1"}, {Name: "hpc2"}}
+	})
+	p.minBackoff = time.Millisecond
+	p.registry = func(servers []collector.PBSServer) (prometheus.Gatherer, error) {
+		r := prometheus.NewRegistry()
+		for _, server := range servers {
+			up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "up", Help: "Up.", ConstLabels: prometheus.Labels{"cluster": server.Name}})
+			up.Set(1)
+			requests := prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total", Help: "Requests.", ConstLabels: prometheus.Labels{"cluster": server.Name}})
+			requests.Add(3)
+			r.MustRegister(up, requests)
+		}
+		return r, nil
+	}
+	return p
+}
+
+func TestPushgateway(t *testing.T) {
+	var (
+		mtx    sync.Mutex
+		paths  []string
+		failed bool
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if r.Method != "PUT" {
+			t.Errorf("got method %s, want PUT", r.Method)
+		}
+		// Fail the first push to check it is retried.
+		if !failed {
+			failed = true
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	if err := testPusher(ts.URL, pushModePushgateway).push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	want := []string{"/metrics/job/pbspro/instance/hpc1", "/metrics/job/pbspro/instance/hpc2"}
+	if strings.Join(paths, " ") != strings.Join(want, " ") {
+		t.Errorf("got pushes to %v, want %v", paths, want)
+	}
+}
+
+func TestPushgatewayClientError(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		attempts int
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		attempts++
+		http.Error(w, "inconsistent metrics", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	err := testPusher(ts.URL, pushModePushgateway).push(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "inconsistent metrics") {
+		t.Errorf("got error %v", err)
+	}
+	// One attempt per server.
+	if attempts != 2 {
+		t.Errorf("client error retried, got %d attempts", attempts)
+	}
+}
+
+func TestRemoteWrite(t *testing.T) {
+	var (
+		attempts int
+		got      writeRequest
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		compressed, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := proto.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	if err := testPusher(ts.URL, pushModeRemoteWrite).push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("got %d attempts, want 2", attempts)
+	}
+
+	var series []string
+	for _, s := range got.Timeseries {
+		var labels []string
+		for _, l := range s.Labels {
+			labels = append(labels, l.Name+"="+l.Value)
+		}
+		if len(s.Samples) != 1 || s.Samples[0].Timestamp == 0 {
+			t.Errorf("unexpected samples %v", s.Samples)
+		}
+		series = append(series, fmt.Sprintf("%s %g", strings.Join(labels, ","), s.Samples[0].Value))
+	}
+	sort.Strings(series)
+	want := []string{
+		"__name__=requests_total,cluster=hpc1,job=pbspro 3",
+		"__name__=requests_total,cluster=hpc2,job=pbspro 3",
+		"__name__=up,cluster=hpc1,job=pbspro 1",
+		"__name__=up,cluster=hpc2,job=pbspro 1",
+	}
+	if strings.Join(series, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got series\n%s\nwant\n%s", strings.Join(series, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRemoteWriteClientError(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	err := testPusher(ts.URL, pushModeRemoteWrite).push(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "out of order sample") {
+		t.Errorf("got error %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("client error retried, got %d attempts", attempts)
+	}
+}
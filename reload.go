@@ -0,0 +1,195 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gsangwell/pbspro_exporter/collector"
+	"github.com/gsangwell/pbspro_exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// loadConfig loads and validates the configuration file. An empty filename
+// yields an empty configuration, so the exporter runs from flags alone.
+func loadConfig(filename string) (*config.Config, error) {
+	if filename == "" {
+		return &config.Config{}, nil
+	}
+	return config.LoadFile(filename)
+}
+
+// serversFromConfig returns the servers of the configuration, or the
+// servers given with --collector.pbspro.url if it has none.
+func serversFromConfig(cfg *config.Config, flagServers []collector.PBSServer) []collector.PBSServer {
+	if len(cfg.Servers) == 0 {
+		return flagServers
+	}
+	servers := make([]collector.PBSServer, 0, len(cfg.Servers))
+	for _, s := range cfg.Servers {
+		servers = append(servers, collector.PBSServer{Name: s.Name, Address: s.Address})
+	}
+	return servers
+}
+
+// redactionFromConfig appends the redaction rules of the configuration to
+// the ones given with flags.
+func redactionFromConfig(cfg *config.Config, flagRedaction collector.Redaction) collector.Redaction {
+	return appendRedaction(flagRedaction, cfg.Redaction)
+}
+
+// appendRedaction appends the rules of a redaction section to the policy.
+func appendRedaction(policy collector.Redaction, redaction config.Redaction) collector.Redaction {
+	r := collector.Redaction{
+		Rules:          append([]collector.RedactionRule{}, policy.Rules...),
+		LabelMaxLength: policy.LabelMaxLength,
+	}
+	if redaction.LabelMaxLength != nil {
+		r.LabelMaxLength = *redaction.LabelMaxLength
+	}
+	for _, rule := range redaction.Rules {
+		r.Rules = append(r.Rules, collector.RedactionRule{
+			Label:       rule.Label,
+			Action:      rule.Action,
+			Regex:       rule.Regex,
+			Replacement: rule.Replacement,
+		})
+	}
+	return r
+}
+
+// moduleSettings returns the collector settings of the /probe modules. A
+// module with collectors enables exactly those, regardless of their flags
+// and of the collectors section. Its redaction applies after the one of the
+// exporter.
+func moduleSettings(cfg *config.Config, flagRedaction collector.Redaction) (map[string]*collector.Settings, error) {
+	policy := redactionFromConfig(cfg, flagRedaction)
+	settings := make(map[string]*collector.Settings, len(cfg.Modules))
+	for name, module := range cfg.Modules {
+		overrides := cfg.Collectors
+		if len(module.Collectors) > 0 {
+			overrides = make(map[string]bool)
+			for _, c := range collector.Collectors() {
+				overrides[c] = false
+			}
+			for _, c := range module.Collectors {
+				overrides[c] = true
+			}
+		}
+		s, err := collector.NewSettings(overrides, appendRedaction(policy, module.Redaction))
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %s", name, err)
+		}
+		settings[name] = s
+	}
+	return settings, nil
+}
+
+// configReloader reloads the configuration file on SIGHUP and on
+// POST /-/reload. A failed reload keeps the previous configuration.
+type configReloader struct {
+	filename      string
+	flagServers   []collector.PBSServer
+	flagRedaction collector.Redaction
+	handler       *handler
+	probe         *probeHandler
+
+	// mtx serialises reloads.
+	mtx           sync.Mutex
+	lastSuccess   prometheus.Gauge
+	lastSuccessTs prometheus.Gauge
+}
+
+func newConfigReloader(filename string, flagServers []collector.PBSServer, flagRedaction collector.Redaction, h *handler, p *probeHandler) *configReloader {
+	c := &configReloader{
+		filename:      filename,
+		flagServers:   flagServers,
+		flagRedaction: flagRedaction,
+		handler:       h,
+		probe:         p,
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "pbspro_exporter",
+			Name:      "config_last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful.",
+		}),
+		lastSuccessTs: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "pbspro_exporter",
+			Name:      "config_last_reload_success_timestamp_seconds",
+			Help:      "Timestamp of the last successful configuration reload.",
+		}),
+	}
+	h.exporterMetricsRegistry.MustRegister(c.lastSuccess, c.lastSuccessTs)
+	c.lastSuccess.Set(1)
+	c.lastSuccessTs.SetToCurrentTime()
+	return c
+}
+
+// reload loads the configuration file and applies it. Scrapes in flight
+// finish with the configuration they started with. The collector overrides,
+// the redaction policy and the servers are validated and built first and
+// then replaced together, so a failed reload changes nothing.
+func (c *configReloader) reload() (err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	log.Infoln("Loading configuration file", c.filename)
+	defer func() {
+		if err != nil {
+			c.lastSuccess.Set(0)
+			return
+		}
+		c.lastSuccess.Set(1)
+		c.lastSuccessTs.SetToCurrentTime()
+	}()
+
+	cfg, err := loadConfig(c.filename)
+	if err != nil {
+		return err
+	}
+	settings, err := collector.NewSettings(cfg.Collectors, redactionFromConfig(cfg, c.flagRedaction))
+	if err != nil {
+		return err
+	}
+	modules, err := moduleSettings(cfg, c.flagRedaction)
+	if err != nil {
+		return err
+	}
+	servers := serversFromConfig(cfg, c.flagServers)
+	innerHandler, err := c.handler.innerHandler(servers, settings.NewPBSCollector)
+	if err != nil {
+		return err
+	}
+
+	c.handler.swap(innerHandler, servers, func() {
+		collector.ApplySettings(settings)
+		c.probe.setConfig(cfg, modules)
+	})
+	return nil
+}
+
+// ServeHTTP implements http.Handler for /-/reload.
+func (c *configReloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := c.reload(); err != nil {
+		log.Errorln("Error reloading config:", err)
+		http.Error(w, fmt.Sprintf("Failed to reload config: %s", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gsangwell/pbspro_exporter/collector"
+	"github.com/gsangwell/pbspro_exporter/config"
+	"github.com/prometheus/common/log"
+)
+
+func TestFailedReloadKeepsConfig(t *testing.T) {
+	defer collector.SetCollectorOverrides(nil)
+
+	dir, err := ioutil.TempDir("", "pbspro_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "config.yml")
+	write := func(content string) {
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := newHandler(false, 0, nil)
+	p := &probeHandler{config: &config.Config{}}
+	r := newConfigReloader(filename, nil, collector.Redaction{}, h, p)
+	write("servers: [{name: hpc1, address: pbs1}]\ncollectors: {job: true, node: false}\n")
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	old := p.config
+
+	// The file is valid, but the reload fails once the collector overrides
+	// are validated, when the redaction policy is compiled.
+	write("servers: [{name: hpc2, address: pbs2}]\ncollectors: {job: false, node: true}\n")
+	r.flagRedaction = collector.Redaction{Rules: []collector.RedactionRule{{Label: "JobOwner", Action: "encrypt"}}}
+	if err := r.reload(); err == nil {
+		t.Fatal("expected the reload to fail")
+	}
+
+	if got, want := h.currentServers(), []collector.PBSServer{{Name: "hpc1", Address: "pbs1"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("servers: got %v, want %v", got, want)
+	}
+	enabled := make(map[string]bool)
+	for _, name := range collector.EnabledCollectors() {
+		enabled[name] = true
+	}
+	if !enabled["job"] || enabled["node"] {
+		t.Errorf("collector overrides changed by a failed reload: %v", collector.EnabledCollectors())
+	}
+	if p.config != old {
+		t.Error("probe config changed by a failed reload")
+	}
+}
+
+func TestModuleSettings(t *testing.T) {
+	cfg, err := config.Load([]byte(`
+collectors: {job: true, node: false}
+modules:
+  nodes: {collectors: [node]}
+  all: {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modules, err := moduleSettings(cfg, collector.Redaction{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string][]string{
+		// A module enables its collectors even if the configuration
+		// disables them.
+		"nodes": {"node"},
+		"all":   {"job"},
+	} {
+		c, err := modules[name].NewProbeCollector(collector.PBSServer{Name: "pbs1", Address: "pbs1"}, log.Base())
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		var got []string
+		for n := range c.Collectors {
+			got = append(got, n)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got collectors %v, want %v", name, got, want)
+		}
+		if !c.Server.Probe {
+			t.Errorf("%s: collector is not a probe", name)
+		}
+	}
+}
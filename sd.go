@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gsangwell/pbspro_exporter/collector"
+	"github.com/prometheus/common/log"
+)
+
+const (
+	sdDefaultPort = 9100
+	sdLabelPrefix = "__meta_pbspro_"
+)
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// targetGroup is a target group of the Prometheus HTTP service discovery.
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// sdHandler serves the PBS nodes as Prometheus HTTP service discovery
+// targets, e.g. for the node_exporter running on every node.
+type sdHandler struct {
+	handler *handler
+	// state returns the state of a server, collector.CurrentState unless
+	// replaced in tests.
+	state func(server collector.PBSServer) (*collector.State, error)
+}
+
+func newSDHandler(h *handler, maxAge time.Duration) *sdHandler {
+	return &sdHandler{
+		handler: h,
+		state: func(server collector.PBSServer) (*collector.State, error) {
+			return collector.CurrentState(server, maxAge)
+		},
+	}
+}
+
+func (h *sdHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	port := sdDefaultPort
+	if v := q.Get("port"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil || p <= 0 || p > 65535 {
+			http.Error(w, fmt.Sprintf("invalid port %q", v), http.StatusBadRequest)
+			return
+		}
+		port = p
+	}
+	clusters := queryValues(q, "cluster")
+	var servers []collector.PBSServer
+	for _, server := range h.handler.currentServers() {
+		if len(clusters) == 0 || contains(clusters, server.Name) {
+			servers = append(servers, server)
+		}
+	}
+
+	// Failing leaves Prometheus with the targets it discovered last,
+	// rather than dropping the nodes of an unreachable PBS server.
+	states, errs := fetchStates(servers, h.state)
+	groups := []targetGroup{}
+	for i, s := range states {
+		if errs[i] != nil {
+			log.Warnf("Couldn't discover the nodes of %s: %s", servers[i].Name, errs[i])
+			http.Error(w, fmt.Sprintf("couldn't get the nodes of %s: %s", servers[i].Name, errs[i]), http.StatusServiceUnavailable)
+			return
+		}
+		groups = append(groups, nodeTargets(s, port)...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(groups); err != nil {
+		log.Errorln("Error writing service discovery response:", err)
+	}
+}
+
+// nodeTargets returns a target group for every node of the state, with the
+// host of its MoM and the given port. The labels are meta labels, available
+// for relabeling:
+//
+//	__meta_pbspro_cluster                 name of the PBS server
+//	__meta_pbspro_node                    node name
+//	__meta_pbspro_node_state              node state, e.g. down,offline
+//	__meta_pbspro_node_ntype              node type
+//	__meta_pbspro_node_queue              queue the node is associated with
+//	__meta_pbspro_node_resource_<name>    resources_available.<name>
+func nodeTargets(s *collector.State, port int) []targetGroup {
+	attribs := make(map[string]map[string]string)
+	for _, bs := range s.NodeAttributes {
+		labels := make(map[string]string)
+		for _, a := range bs.Attributes {
+			switch {
+			case a.Name == "queue":
+				labels[sdLabelPrefix+"node_queue"] = a.Value
+			case a.Name == "resources_available" && a.Resource != "":
+				labels[sdLabelPrefix+"node_resource_"+invalidLabelChars.ReplaceAllString(strings.ToLower(a.Resource), "_")] = a.Value
+			}
+		}
+		attribs[bs.Name] = labels
+	}
+
+	var groups []targetGroup
+	for _, node := range s.Nodes {
+		host := node.Mom
+		if host == "" {
+			host = node.NodeName
+		}
+		labels := map[string]string{
+			sdLabelPrefix + "cluster":    s.Server.Name,
+			sdLabelPrefix + "node":       node.NodeName,
+			sdLabelPrefix + "node_state": node.State,
+			sdLabelPrefix + "node_ntype": node.Ntype,
+		}
+		for k, v := range attribs[node.NodeName] {
+			labels[k] = v
+		}
+		groups = append(groups, targetGroup{
+			Targets: []string{net.JoinHostPort(host, strconv.Itoa(port))},
+			Labels:  labels,
+		})
+	}
+	return groups
+}
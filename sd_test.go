@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gsangwell/go_pbspro/qstat"
+	"github.com/gsangwell/go_pbspro/utils"
+	"github.com/gsangwell/pbspro_exporter/collector"
+)
+
+func testSDHandler(fail bool) *sdHandler {
+	h := &handler{servers: []collector.PBSServer{{Name: "hpc1", Address: "10.0.0.1"}, {Name: "hpc2", Address: "10.0.0.2"}}}
+	hpc1 := collector.NewState(h.servers[0], time.Now(), nil, nil,
+		[]qstat.QstatNodeInfo{
+			{NodeName: "n1", Mom: "n1.example.com", Ntype: "PBS", State: "free"},
+			{NodeName: "n2", Ntype: "PBS", State: "down,offline"},
+		}, nil)
+	hpc1.NodeAttributes = []utils.BatchStatus{{Name: "n1", Attributes: []utils.Attrib{
+		{Name: "queue", Value: "gpu"},
+		{Name: "resources_available", Resource: "ngpus", Value: "4"},
+		{Name: "resources_available", Resource: "rack-id", Value: "r12"},
+		{Name: "state", Value: "free"},
+	}}}
+	hpc2 := collector.NewState(h.servers[1], time.Now(), nil, nil, []qstat.QstatNodeInfo{{NodeName: "m1", State: "free"}}, nil)
+	return &sdHandler{
+		handler: h,
+		state: func(server collector.PBSServer) (*collector.State, error) {
+			if server.Name == "hpc2" {
+				if fail {
+					return nil, errors.New("connection refused")
+				}
+				return hpc2, nil
+			}
+			return hpc1, nil
+		},
+	}
+}
+
+func TestSD(t *testing.T) {
+	w := httptest.NewRecorder()
+	testSDHandler(false).ServeHTTP(w, httptest.NewRequest("GET", "/sd?cluster=hpc1&port=9400", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	var groups []targetGroup
+	if err := json.Unmarshal(w.Body.Bytes(), &groups); err != nil {
+		t.Fatal(err)
+	}
+	want := []targetGroup{
+		{Targets: []string{"n1.example.com:9400"}, Labels: map[string]string{
+			"__meta_pbspro_cluster":               "hpc1",
+			"__meta_pbspro_node":                  "n1",
+			"__meta_pbspro_node_state":            "free",
+			"__meta_pbspro_node_ntype":            "PBS",
+			"__meta_pbspro_node_queue":            "gpu",
+			"__meta_pbspro_node_resource_ngpus":   "4",
+			"__meta_pbspro_node_resource_rack_id": "r12",
+		}},
+		{Targets: []string{"n2:9400"}, Labels: map[string]string{
+			"__meta_pbspro_cluster":    "hpc1",
+			"__meta_pbspro_node":       "n2",
+			"__meta_pbspro_node_state": "down,offline",
+			"__meta_pbspro_node_ntype": "PBS",
+		}},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("got %+v, want %+v", groups, want)
+	}
+
+	w = httptest.NewRecorder()
+	testSDHandler(false).ServeHTTP(w, httptest.NewRequest("GET", "/sd", nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &groups); err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 3 || groups[2].Targets[0] != "m1:9100" {
+		t.Errorf("got %+v, want the nodes of both clusters on the default port", groups)
+	}
+}
+
+func TestSDErrors(t *testing.T) {
+	for url, code := range map[string]int{
+		"/sd":                     http.StatusServiceUnavailable,
+		"/sd?cluster=hpc1&port=x": http.StatusBadRequest,
+		"/sd?port=70000":          http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		testSDHandler(true).ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != code {
+			t.Errorf("%s: got status %d, want %d", url, w.Code, code)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gsangwell/pbspro_exporter/collector"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/version"
+)
+
+// healthyHandler reports that the process is alive.
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Healthy.")
+}
+
+// readyHandler reports whether every PBS server was contacted successfully
+// within maxAge and none of its collectors failed since. A server that was
+// not contacted recently is pinged, so the exporter becomes ready before
+// Prometheus scrapes it.
+type readyHandler struct {
+	handler *handler
+	maxAge  time.Duration
+}
+
+func (rh *readyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, server := range rh.handler.currentServers() {
+		if failed := collector.FailedScrapes(server, rh.maxAge); len(failed) > 0 {
+			log.Warnf("PBS server %s is not ready: collector %s failed: %s", server.Name, failed[0].Collector, failed[0].Err)
+			http.Error(w, fmt.Sprintf("PBS server %s is failing: collector %s failed: %s", server.Name, failed[0].Collector, failed[0].Err), http.StatusServiceUnavailable)
+			return
+		}
+		if time.Since(collector.LastContact(server)) <= rh.maxAge {
+			continue
+		}
+		if err := collector.Ping(server); err != nil {
+			log.Warnf("PBS server %s is not ready: %s", server.Name, err)
+			http.Error(w, fmt.Sprintf("PBS server %s is not reachable: %s", server.Name, err), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Ready.")
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<html>
+<head><title>PBSPro Exporter Status</title></head>
+<body>
+<h1>PBSPro Exporter Status</h1>
+<h2>PBS servers</h2>
+<table border="1">
+<tr><th>Name</th><th>Address</th><th>Last contact</th><th>Status</th></tr>
+{{range .Servers}}<tr><td>{{.Name}}</td><td>{{.Address}}</td><td>{{if .LastContact.IsZero}}never{{else}}{{.LastContact.Format "2006-01-02T15:04:05Z07:00"}}{{end}}</td><td>{{if .Failed}}failing:{{range .Failed}} {{.Collector}}{{end}}{{else if .LastContact.IsZero}}unknown{{else}}ok{{end}}</td></tr>
+{{end}}</table>
+<h2>Enabled collectors</h2>
+<ul>
+{{range .Collectors}}<li>{{.}}</li>
+{{end}}</ul>
+<h2>Last scrapes</h2>
+<table border="1">
+<tr><th>Server</th><th>Collector</th><th>Time</th><th>Duration</th><th>Error</th></tr>
+{{range .Scrapes}}<tr><td>{{.Server}}</td><td>{{.Collector}}</td><td>{{.Time.Format "2006-01-02T15:04:05Z07:00"}}</td><td>{{.Duration}}</td><td>{{if .Err}}{{.Err}}{{end}}</td></tr>
+{{end}}</table>
+<h2>Build information</h2>
+<p>{{.Version}}</p>
+<p>{{.BuildContext}}</p>
+</body>
+</html>
+`))
+
+type serverStatus struct {
+	collector.PBSServer
+	LastContact time.Time
+	// Failed are the collectors whose last scrape failed within maxAge.
+	Failed []collector.ScrapeStatus
+}
+
+// statusHandler serves the /status page. A server is shown as failing if a
+// collector failed within maxAge.
+type statusHandler struct {
+	handler *handler
+	maxAge  time.Duration
+}
+
+func (s *statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var servers []serverStatus
+	for _, server := range s.handler.currentServers() {
+		servers = append(servers, serverStatus{server, collector.LastContact(server), collector.FailedScrapes(server, s.maxAge)})
+	}
+	data := struct {
+		Servers      []serverStatus
+		Collectors   []string
+		Scrapes      []collector.ScrapeStatus
+		Version      string
+		BuildContext string
+	}{
+		Servers:      servers,
+		Collectors:   collector.EnabledCollectors(),
+		Scrapes:      collector.ScrapeStatuses(),
+		Version:      version.Info(),
+		BuildContext: version.BuildContext(),
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, data); err != nil {
+		log.Errorln("Error rendering status page:", err)
+	}
+}
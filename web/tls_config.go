@@ -0,0 +1,327 @@
+// Copyright 2019 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Derived from web/tls_config.go of github.com/prometheus/exporter-toolkit, changed
+// for the pbspro_exporter.
+
+// Package web serves the exporter over HTTPS with optional basic
+// authentication. The configuration file uses the web configuration format
+// of the Prometheus exporter-toolkit, so existing files can be reused.
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+
+	"github.com/prometheus/common/log"
+	"gopkg.in/yaml.v2"
+)
+
+var errNoTLSConfig = errors.New("TLS config is not present")
+
+// Config is the content of the --web.config.file.
+type Config struct {
+	TLSConfig  TLSStruct         `yaml:"tls_server_config"`
+	HTTPConfig HTTPStruct        `yaml:"http_server_config"`
+	Users      map[string]string `yaml:"basic_auth_users"`
+}
+
+// TLSStruct configures the TLS listener.
+type TLSStruct struct {
+	TLSCertPath              string     `yaml:"cert_file"`
+	TLSKeyPath               string     `yaml:"key_file"`
+	ClientAuth               string     `yaml:"client_auth_type"`
+	ClientCAs                string     `yaml:"client_ca_file"`
+	CipherSuites             []cipher   `yaml:"cipher_suites"`
+	CurvePreferences         []curve    `yaml:"curve_preferences"`
+	MinVersion               tlsVersion `yaml:"min_version"`
+	MaxVersion               tlsVersion `yaml:"max_version"`
+	PreferServerCipherSuites bool       `yaml:"prefer_server_cipher_suites"`
+}
+
+// HTTPStruct configures the HTTP server.
+type HTTPStruct struct {
+	HTTP2   bool              `yaml:"http2"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+// SetDirectory joins any relative file paths with dir.
+func (t *TLSStruct) SetDirectory(dir string) {
+	t.TLSCertPath = joinDir(dir, t.TLSCertPath)
+	t.TLSKeyPath = joinDir(dir, t.TLSKeyPath)
+	t.ClientCAs = joinDir(dir, t.ClientCAs)
+}
+
+func joinDir(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func getConfig(configPath string) (*Config, error) {
+	content, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{
+		TLSConfig: TLSStruct{
+			MinVersion:               tls.VersionTLS12,
+			MaxVersion:               tls.VersionTLS13,
+			PreferServerCipherSuites: true,
+		},
+		HTTPConfig: HTTPStruct{HTTP2: true},
+	}
+	if err := yaml.UnmarshalStrict(content, c); err != nil {
+		return nil, err
+	}
+	c.TLSConfig.SetDirectory(filepath.Dir(configPath))
+	return c, nil
+}
+
+func getTLSConfig(configPath string) (*tls.Config, error) {
+	c, err := getConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return ConfigToTLSConfig(&c.TLSConfig)
+}
+
+// ConfigToTLSConfig generates the golang tls.Config from the TLSStruct config.
+func ConfigToTLSConfig(c *TLSStruct) (*tls.Config, error) {
+	if c.TLSCertPath == "" && c.TLSKeyPath == "" && c.ClientAuth == "" && c.ClientCAs == "" {
+		return nil, errNoTLSConfig
+	}
+	if c.TLSCertPath == "" {
+		return nil, errors.New("missing cert_file")
+	}
+	if c.TLSKeyPath == "" {
+		return nil, errors.New("missing key_file")
+	}
+
+	loadCert := func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertPath, c.TLSKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load X509KeyPair: %s", err)
+		}
+		return &cert, nil
+	}
+	// Confirm that certificate and key paths are valid.
+	if _, err := loadCert(); err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion:               uint16(c.MinVersion),
+		MaxVersion:               uint16(c.MaxVersion),
+		PreferServerCipherSuites: c.PreferServerCipherSuites,
+	}
+	if cfg.MinVersion > cfg.MaxVersion {
+		return nil, errors.New("min_version is higher than max_version")
+	}
+	cfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return loadCert()
+	}
+
+	for _, cs := range c.CipherSuites {
+		cfg.CipherSuites = append(cfg.CipherSuites, uint16(cs))
+	}
+	for _, cp := range c.CurvePreferences {
+		cfg.CurvePreferences = append(cfg.CurvePreferences, tls.CurveID(cp))
+	}
+
+	if c.ClientCAs != "" {
+		clientCAPool := x509.NewCertPool()
+		clientCAFile, err := ioutil.ReadFile(c.ClientCAs)
+		if err != nil {
+			return nil, err
+		}
+		if !clientCAPool.AppendCertsFromPEM(clientCAFile) {
+			return nil, fmt.Errorf("no certificates found in %s", c.ClientCAs)
+		}
+		cfg.ClientCAs = clientCAPool
+	}
+
+	switch c.ClientAuth {
+	case "RequestClientCert":
+		cfg.ClientAuth = tls.RequestClientCert
+	case "RequireAnyClientCert", "RequireClientCert": // Preserved for backwards compatibility.
+		cfg.ClientAuth = tls.RequireAnyClientCert
+	case "VerifyClientCertIfGiven":
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case "RequireAndVerifyClientCert":
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	case "", "NoClientCert":
+		cfg.ClientAuth = tls.NoClientCert
+	default:
+		return nil, fmt.Errorf("invalid ClientAuth: %s", c.ClientAuth)
+	}
+
+	if c.ClientCAs != "" && cfg.ClientAuth == tls.NoClientCert {
+		return nil, errors.New("client's certificate authority cannot be used without client_auth_type")
+	}
+
+	return cfg, nil
+}
+
+// ListenAndServe starts the server on server.Addr. Depending on the
+// configuration file at configPath it serves HTTPS and requires basic
+// authentication. An empty configPath serves plain HTTP.
+func ListenAndServe(server *http.Server, configPath string) error {
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	return Serve(listener, server, configPath)
+}
+
+// Serve starts the server on the given listener, see ListenAndServe.
+func Serve(l net.Listener, server *http.Server, configPath string) error {
+	if configPath == "" {
+		log.Infoln("TLS is disabled.")
+		return server.Serve(l)
+	}
+
+	if err := Validate(configPath); err != nil {
+		return err
+	}
+
+	c, err := getConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	handler := server.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	server.Handler = &webHandler{
+		configPath: configPath,
+		handler:    handler,
+	}
+
+	cfg, err := ConfigToTLSConfig(&c.TLSConfig)
+	switch err {
+	case nil:
+		if !c.HTTPConfig.HTTP2 {
+			server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		}
+		// Valid TLS config.
+		log.Infoln("TLS is enabled.")
+	case errNoTLSConfig:
+		// No TLS config, back to plain HTTP.
+		log.Infoln("TLS is disabled.")
+		return server.Serve(l)
+	default:
+		// Invalid TLS config.
+		return err
+	}
+
+	server.TLSConfig = cfg
+
+	// Set the GetConfigForClient method of the HTTPS server so that the
+	// config and certs are reloaded on new connections.
+	server.TLSConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		config, err := getTLSConfig(configPath)
+		if err != nil {
+			return nil, err
+		}
+		config.NextProtos = server.TLSConfig.NextProtos
+		return config, nil
+	}
+	return server.ServeTLS(l, "", "")
+}
+
+// Validate validates a web configuration file.
+func Validate(configPath string) error {
+	if configPath == "" {
+		return nil
+	}
+	c, err := getConfig(configPath)
+	if err != nil {
+		return err
+	}
+	_, err = ConfigToTLSConfig(&c.TLSConfig)
+	if err == errNoTLSConfig {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	return validateUsers(c.Users)
+}
+
+type cipher uint16
+
+func (c *cipher) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	for _, cs := range tls.CipherSuites() {
+		if cs.Name == s {
+			*c = cipher(cs.ID)
+			return nil
+		}
+	}
+	return errors.New("unknown cipher: " + s)
+}
+
+type curve tls.CurveID
+
+var curves = map[string]curve{
+	"CurveP256": (curve)(tls.CurveP256),
+	"CurveP384": (curve)(tls.CurveP384),
+	"CurveP521": (curve)(tls.CurveP521),
+	"X25519":    (curve)(tls.X25519),
+}
+
+func (c *curve) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	if curveid, ok := curves[s]; ok {
+		*c = curveid
+		return nil
+	}
+	return errors.New("unknown curve: " + s)
+}
+
+type tlsVersion uint16
+
+var tlsVersions = map[string]tlsVersion{
+	"TLS13": (tlsVersion)(tls.VersionTLS13),
+	"TLS12": (tlsVersion)(tls.VersionTLS12),
+	"TLS11": (tlsVersion)(tls.VersionTLS11),
+	"TLS10": (tlsVersion)(tls.VersionTLS10),
+}
+
+func (tv *tlsVersion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	if v, ok := tlsVersions[s]; ok {
+		*tv = v
+		return nil
+	}
+	return errors.New("unknown TLS version: " + s)
+}
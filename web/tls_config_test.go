@@ -0,0 +1,364 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testCA is a certificate authority generated for a test.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a PEM certificate and key signed by the CA.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// testEnv holds the certificates of a test, written to a temporary
+// directory next to the web configuration file.
+type testEnv struct {
+	dir        string
+	ca         *testCA
+	clientCert tls.Certificate
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	dir, err := ioutil.TempDir("", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := newTestCA(t, "test-ca")
+	serverCert, serverKey := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+
+	for name, content := range map[string][]byte{
+		"ca.crt":     ca.pem,
+		"server.crt": serverCert,
+		"server.key": serverKey,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cert, err := tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testEnv{dir: dir, ca: ca, clientCert: cert}
+}
+
+func (e *testEnv) writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(e.dir, "web.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func (e *testEnv) client(clientCert bool, maxVersion uint16) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(e.ca.cert)
+	cfg := &tls.Config{RootCAs: pool, MaxVersion: maxVersion}
+	if clientCert {
+		cfg.Certificates = []tls.Certificate{e.clientCert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+}
+
+func startServer(t *testing.T, env *testEnv, config string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello World!"))
+	})
+	server := &http.Server{Handler: mux}
+	configPath := env.writeConfig(t, config)
+	go Serve(l, server, configPath)
+	return l.Addr().String()
+}
+
+func TestServeTLS(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	addr := startServer(t, env, `
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+`)
+
+	resp, err := env.client(false, 0).Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want status 200, got %d", resp.StatusCode)
+	}
+	if resp.TLS == nil {
+		t.Fatal("response was not served over TLS")
+	}
+
+	// Go answers plain HTTP on a TLS listener with 400 Bad Request.
+	plain, err := http.Get("http://" + addr + "/")
+	if err == nil {
+		plain.Body.Close()
+		if plain.StatusCode != http.StatusBadRequest {
+			t.Fatalf("plain HTTP request to TLS server got status %d", plain.StatusCode)
+		}
+	}
+}
+
+func TestServeTLSMinVersion(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	addr := startServer(t, env, `
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+  min_version: TLS13
+`)
+
+	if _, err := env.client(false, tls.VersionTLS12).Get("https://" + addr + "/"); err == nil {
+		t.Fatal("TLS 1.2 client connected to a TLS 1.3 only server")
+	}
+	resp, err := env.client(false, tls.VersionTLS13).Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestServeMutualTLS(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	addr := startServer(t, env, `
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+  client_auth_type: RequireAndVerifyClientCert
+  client_ca_file: ca.crt
+`)
+
+	if _, err := env.client(false, 0).Get("https://" + addr + "/"); err == nil {
+		t.Fatal("client without certificate was accepted")
+	}
+
+	resp, err := env.client(true, 0).Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want status 200, got %d", resp.StatusCode)
+	}
+
+	// A certificate from another CA must be rejected.
+	other := newTestCA(t, "other-ca")
+	certPEM, keyPEM := other.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := env.client(false, 0)
+	client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{cert}
+	if _, err := client.Get("https://" + addr + "/"); err == nil {
+		t.Fatal("client certificate from an unknown CA was accepted")
+	}
+}
+
+func TestServeBasicAuth(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startServer(t, env, `
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+http_server_config:
+  headers:
+    X-Frame-Options: deny
+basic_auth_users:
+  alice: `+string(hash)+`
+`)
+
+	for _, tc := range []struct {
+		user, pass string
+		auth       bool
+		status     int
+	}{
+		{status: http.StatusUnauthorized},
+		{user: "alice", pass: "secret", auth: true, status: http.StatusOK},
+		{user: "alice", pass: "wrong", auth: true, status: http.StatusUnauthorized},
+		{user: "bob", pass: "secret", auth: true, status: http.StatusUnauthorized},
+		// Served from the cache the second time.
+		{user: "alice", pass: "secret", auth: true, status: http.StatusOK},
+	} {
+		req, err := http.NewRequest("GET", "https://"+addr+"/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.auth {
+			req.SetBasicAuth(tc.user, tc.pass)
+		}
+		resp, err := env.client(false, 0).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s/%s: want status %d, got %d", tc.user, tc.pass, tc.status, resp.StatusCode)
+		}
+		if got := resp.Header.Get("X-Frame-Options"); got != "deny" {
+			t.Errorf("%s/%s: want X-Frame-Options header deny, got %q", tc.user, tc.pass, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	env := newTestEnv(t)
+	defer os.RemoveAll(env.dir)
+
+	for _, tc := range []struct {
+		name, config, err string
+	}{
+		{
+			name:   "empty",
+			config: ``,
+		},
+		{
+			name:   "basic auth only",
+			config: "basic_auth_users:\n  alice: " + dummyHash,
+		},
+		{
+			name:   "unknown field",
+			config: "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  bogus: true",
+			err:    "field bogus not found",
+		},
+		{
+			name:   "missing key",
+			config: "tls_server_config:\n  cert_file: server.crt",
+			err:    "missing key_file",
+		},
+		{
+			name:   "missing cert file",
+			config: "tls_server_config:\n  cert_file: nope.crt\n  key_file: server.key",
+			err:    "failed to load X509KeyPair",
+		},
+		{
+			name:   "client CA without client auth",
+			config: "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  client_ca_file: ca.crt",
+			err:    "cannot be used without client_auth_type",
+		},
+		{
+			name:   "invalid client auth",
+			config: "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  client_auth_type: Sometimes",
+			err:    "invalid ClientAuth",
+		},
+		{
+			name:   "min above max version",
+			config: "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  min_version: TLS13\n  max_version: TLS12",
+			err:    "min_version is higher than max_version",
+		},
+		{
+			name:   "unknown TLS version",
+			config: "tls_server_config:\n  cert_file: server.crt\n  key_file: server.key\n  min_version: SSL3",
+			err:    "unknown TLS version",
+		},
+		{
+			name:   "plain text password",
+			config: "basic_auth_users:\n  alice: secret",
+			err:    "invalid bcrypt hash",
+		},
+	} {
+		err := Validate(env.writeConfig(t, tc.config))
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %s", tc.name, err)
+		case tc.err != "" && err == nil:
+			t.Errorf("%s: expected error containing %q", tc.name, tc.err)
+		case tc.err != "" && !strings.Contains(err.Error(), tc.err):
+			t.Errorf("%s: expected error containing %q, got %q", tc.name, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// Derived from web/users.go of github.com/prometheus/exporter-toolkit, changed
+// for the pbspro_exporter.
+
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/common/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against for unknown users, so that the response
+// time does not reveal which user names exist.
+const dummyHash = "$2y$10$QOauhQNbBCuQDKes6eFzPeMqBSjb7Mr5DUmpZ/VcEd00UAV/LDeSi"
+
+// validateUsers checks that all basic_auth_users passwords are bcrypt
+// hashes.
+func validateUsers(users map[string]string) error {
+	for user, hash := range users {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("basic_auth_users: invalid bcrypt hash for user %q: %s", user, err)
+		}
+	}
+	return nil
+}
+
+// webHandler sets the configured response headers and enforces basic
+// authentication. The configuration is read on every request so password
+// changes apply without a restart.
+type webHandler struct {
+	configPath string
+	handler    http.Handler
+
+	// cache holds the results of recent bcrypt comparisons, which are
+	// deliberately slow, keyed by a hash of user, hash and password.
+	cacheMtx sync.Mutex
+	cache    map[string]bool
+}
+
+func (u *webHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, err := getConfig(u.configPath)
+	if err != nil {
+		log.Errorln("Unable to parse web configuration file:", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	for k, v := range c.HTTPConfig.Headers {
+		w.Header().Set(k, v)
+	}
+
+	if len(c.Users) == 0 {
+		u.handler.ServeHTTP(w, r)
+		return
+	}
+
+	user, pass, auth := r.BasicAuth()
+	if auth {
+		hash, ok := c.Users[user]
+		if !ok {
+			hash = dummyHash
+		}
+		if u.authenticated(user, hash, pass) && ok {
+			u.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("WWW-Authenticate", "Basic")
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+func (u *webHandler) authenticated(user, hash, pass string) bool {
+	sum := sha256.Sum256([]byte(user + "\x00" + hash + "\x00" + pass))
+	key := hex.EncodeToString(sum[:])
+
+	u.cacheMtx.Lock()
+	ok, cached := u.cache[key]
+	u.cacheMtx.Unlock()
+	if cached {
+		return ok
+	}
+
+	ok = bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+
+	u.cacheMtx.Lock()
+	if u.cache == nil || len(u.cache) > 100 {
+		u.cache = make(map[string]bool)
+	}
+	u.cache[key] = ok
+	u.cacheMtx.Unlock()
+	return ok
+}